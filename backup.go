@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// backupKeep is how many backups are kept per config file; older ones are
+// removed when a new one is made.
+const backupKeep = 20
+
+// backupIDFormat names backups by the time they were taken, so IDs sort in
+// time order.
+const backupIDFormat = "20060102-150405.000000"
+
+// Backup is the content a config file had before 55h wrote it. The content
+// is stored next to its description as <ID>.bak and <ID>.json.
+type Backup struct {
+	ID      string `json:"-"`
+	Path    string `json:"path"`
+	Created string `json:"created"`
+	Reason  string `json:"reason,omitempty"`
+	Size    int    `json:"size"`
+}
+
+func getBackupDir() string {
+	configPath := getAppConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "backups")
+}
+
+// resolveWriteTarget follows symlinks to the file that actually holds the
+// content, so a config linked from a dotfiles repo is updated there instead
+// of being replaced by a regular file. The target does not need to exist.
+func resolveWriteTarget(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < 40; i++ {
+		info, err := os.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(path), link)
+		}
+		path = link
+	}
+	return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+}
+
+// writeConfigFile is the single place config files are written. It backs up
+// the old content, writes a temp file next to the target, syncs it and
+// renames it into place, so a crash leaves either the old or the new file.
+// The file keeps its mode and owner; new files are created 0600. The
+// returned undoFile has an empty Path when data was already the content.
+func writeConfigFile(path string, data []byte, reason string) (undoFile, error) {
+	target, err := resolveWriteTarget(path)
+	if err != nil {
+		return undoFile{}, err
+	}
+	change := undoFile{Path: target, Hash: contentHash(data)}
+	mode := os.FileMode(0600)
+	uid, gid := -1, -1
+	if info, err := os.Stat(target); err == nil {
+		mode = info.Mode().Perm()
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(st.Uid), int(st.Gid)
+		}
+		old, err := os.ReadFile(target)
+		if err != nil {
+			return undoFile{}, err
+		}
+		if string(old) == string(data) {
+			return undoFile{}, nil
+		}
+		backup, err := saveBackup(target, old, reason)
+		if err != nil {
+			return undoFile{}, fmt.Errorf("failed to back up %s: %v", target, err)
+		}
+		change.Backup = backup.ID
+	} else if !os.IsNotExist(err) {
+		return undoFile{}, err
+	}
+
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return undoFile{}, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".55h-*")
+	if err != nil {
+		return undoFile{}, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		return undoFile{}, err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return undoFile{}, err
+	}
+	if uid >= 0 {
+		// Only root can give a file away; anyone else already owns it.
+		_ = tmp.Chown(uid, gid)
+	}
+	if err := tmp.Sync(); err != nil {
+		return undoFile{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return undoFile{}, err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return undoFile{}, err
+	}
+	committed = true
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return change, nil
+}
+
+// saveBackup stores content as a new backup of path and prunes old ones.
+func saveBackup(path string, content []byte, reason string) (Backup, error) {
+	dir := getBackupDir()
+	if dir == "" {
+		return Backup{}, fmt.Errorf("unable to resolve backup directory")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Backup{}, err
+	}
+	now := time.Now()
+	backup := Backup{
+		Path:    path,
+		Created: now.Format(time.RFC3339),
+		Reason:  reason,
+		Size:    len(content),
+	}
+	// Claim the ID with the content file so two writes in the same
+	// microsecond still get their own backup.
+	var file *os.File
+	for {
+		backup.ID = now.Format(backupIDFormat)
+		f, err := os.OpenFile(filepath.Join(dir, backup.ID+".bak"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			file = f
+			break
+		}
+		if !os.IsExist(err) {
+			return Backup{}, err
+		}
+		now = now.Add(time.Microsecond)
+	}
+	_, err := file.Write(content)
+	if syncErr := file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filepath.Join(dir, backup.ID+".bak"))
+		return Backup{}, err
+	}
+	meta, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, backup.ID+".json"), meta, 0600); err != nil {
+		os.Remove(filepath.Join(dir, backup.ID+".bak"))
+		return Backup{}, err
+	}
+	pruneBackups(path)
+	return backup, nil
+}
+
+// loadBackups lists the stored backups, oldest first.
+func loadBackups() []Backup {
+	dir := getBackupDir()
+	if dir == "" {
+		return nil
+	}
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil
+	}
+	backups := []Backup{}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		backup := Backup{}
+		if err := json.Unmarshal(data, &backup); err != nil || backup.Path == "" {
+			continue
+		}
+		backup.ID = strings.TrimSuffix(filepath.Base(name), ".json")
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].ID < backups[j].ID
+	})
+	return backups
+}
+
+// pruneBackups keeps the newest backupKeep backups of path.
+func pruneBackups(path string) {
+	ofPath := []Backup{}
+	for _, backup := range loadBackups() {
+		if backup.Path == path {
+			ofPath = append(ofPath, backup)
+		}
+	}
+	for i := 0; i < len(ofPath)-backupKeep; i++ {
+		removeBackup(ofPath[i])
+	}
+}
+
+func removeBackup(backup Backup) {
+	dir := getBackupDir()
+	os.Remove(filepath.Join(dir, backup.ID+".json"))
+	os.Remove(filepath.Join(dir, backup.ID+".bak"))
+}
+
+// findBackup returns the backup with id, or the only one whose ID starts
+// with it.
+func findBackup(id string) (Backup, error) {
+	matches := []Backup{}
+	for _, backup := range loadBackups() {
+		if backup.ID == id {
+			return backup, nil
+		}
+		if strings.HasPrefix(backup.ID, id) {
+			matches = append(matches, backup)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return Backup{}, fmt.Errorf("no backup %q; see 55h backups list", id)
+	}
+	return Backup{}, fmt.Errorf("backup ID %q is ambiguous (%d backups start with it)", id, len(matches))
+}
+
+func (backup Backup) Content() ([]byte, error) {
+	return os.ReadFile(filepath.Join(getBackupDir(), backup.ID+".bak"))
+}
+
+// handleBackupsList implements: 55h backups list [file]
+func handleBackupsList(inv *cliInvocation) error {
+	if len(inv.Args) > 1 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	filter := ""
+	if len(inv.Args) == 1 {
+		abs, err := filepath.Abs(inv.Args[0])
+		if err != nil {
+			return err
+		}
+		if filter, err = resolveWriteTarget(abs); err != nil {
+			return err
+		}
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "ID\tCREATED\tSIZE\tFILE\tREASON")
+	backups := loadBackups()
+	for i := len(backups) - 1; i >= 0; i-- {
+		backup := backups[i]
+		if filter != "" && backup.Path != filter {
+			continue
+		}
+		created := backup.Created
+		if t, err := time.Parse(time.RFC3339, created); err == nil {
+			created = t.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(out, "%s\t%s\t%d\t%s\t%s\n", backup.ID, created, backup.Size, backup.Path, backup.Reason)
+	}
+	return out.Flush()
+}
+
+// handleBackupsRestore implements: 55h backups restore <id> [--yes] [--dry-run]
+// The current content is backed up first, so a restore can be undone by
+// restoring that backup.
+func handleBackupsRestore(inv *cliInvocation) error {
+	args, yes, dryRun := inv.Args, inv.Has("yes"), inv.Has("dry-run")
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	backup, err := findBackup(args[0])
+	if err != nil {
+		return err
+	}
+	content, err := backup.Content()
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %v", err)
+	}
+	current, err := os.ReadFile(backup.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	diff := unifiedDiff(backup.Path, current, content)
+	if diff == "" {
+		fmt.Printf("%s already matches backup %s\n", backup.Path, backup.ID)
+		return nil
+	}
+	fmt.Print(diff)
+	if dryRun {
+		return nil
+	}
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Restore %s from backup %s?", backup.Path, backup.ID))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+	reason := "restore " + backup.ID
+	change, err := restoreBackup(backup.Path, backup.ID, reason)
+	if change.Path != "" {
+		recordUndo(reason, []undoFile{change})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestHome points the 55h state directory (backups, undo journal, logs)
+// at a fresh temporary home.
+func useTestHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return home
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// old is the content before the write; nil means no file.
+		old     []byte
+		mode    os.FileMode
+		data    string
+		want    os.FileMode
+		changed bool
+	}{
+		{name: "new file is private", data: "Host a\n", want: 0600, changed: true},
+		{name: "mode is kept", old: []byte("Host a\n"), mode: 0640, data: "Host b\n", want: 0640, changed: true},
+		{name: "wide mode is kept too", old: []byte("Host a\n"), mode: 0644, data: "Host b\n", want: 0644, changed: true},
+		{name: "same content is not written", old: []byte("Host a\n"), mode: 0600, data: "Host a\n", want: 0600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHome(t)
+			path := filepath.Join(t.TempDir(), "config")
+			if tt.old != nil {
+				if err := os.WriteFile(path, tt.old, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			change, err := writeConfigFile(path, []byte(tt.data), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.data {
+				t.Errorf("content = %q, want %q", got, tt.data)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != tt.want {
+				t.Errorf("mode = %o, want %o", info.Mode().Perm(), tt.want)
+			}
+			if (change.Path != "") != tt.changed {
+				t.Errorf("change = %+v, want changed %v", change, tt.changed)
+			}
+			// The old content is backed up before it is replaced.
+			if tt.changed && tt.old != nil {
+				backup, err := readBackup(change.Backup)
+				if err != nil || string(backup) != string(tt.old) {
+					t.Errorf("backup %q = %q, %v; want %q", change.Backup, backup, err, tt.old)
+				}
+			}
+			// No temp file is left next to the target.
+			entries, _ := os.ReadDir(filepath.Dir(path))
+			if len(entries) != 1 {
+				t.Errorf("directory holds %d files, want only the config", len(entries))
+			}
+		})
+	}
+}
+
+func TestWriteConfigFileThroughSymlink(t *testing.T) {
+	useTestHome(t)
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles-config")
+	link := filepath.Join(dir, "config")
+	if err := os.WriteFile(target, []byte("Host a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeConfigFile(link, []byte("Host b\n"), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("%s is no longer a symlink", link)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "Host b\n" {
+		t.Errorf("target = %q, want the new content", got)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	useTestHome(t)
+	dir := t.TempDir()
+	path, other := filepath.Join(dir, "config"), filepath.Join(dir, "other")
+	if _, err := saveBackup(other, []byte("other"), "test"); err != nil {
+		t.Fatal(err)
+	}
+	first := ""
+	for i := 0; i < backupKeep+3; i++ {
+		backup, err := saveBackup(path, []byte{byte('a' + i)}, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = backup.ID
+		}
+	}
+	counts := map[string]int{}
+	for _, backup := range loadBackups() {
+		counts[backup.Path]++
+		if backup.ID == first {
+			t.Errorf("oldest backup %s was kept", first)
+		}
+	}
+	if counts[path] != backupKeep || counts[other] != 1 {
+		t.Errorf("kept %d of config and %d of other, want %d and 1", counts[path], counts[other], backupKeep)
+	}
+}
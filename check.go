@@ -0,0 +1,793 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// CheckStatus is the outcome of a connection test, as shown in the host list.
+type CheckStatus int
+
+const (
+	CheckUnknown CheckStatus = iota
+	CheckRunning
+	CheckOK
+	CheckAuthFailed
+	CheckTimeout
+	// CheckUnreachable is no longer set; results stored by older versions
+	// still read as it.
+	CheckUnreachable
+	CheckHostKeyChanged
+	CheckDNSFailed
+	CheckRefused
+	CheckJumpFailed
+	// CheckFailed is a failure whose cause ssh's output doesn't tell.
+	CheckFailed
+)
+
+// checkWorkers bounds how many ssh test processes run at once.
+const checkWorkers = 16
+
+// checkTimeout caps a single test, including authentication, beyond the
+// ConnectTimeout passed to ssh.
+const checkTimeout = 20 * time.Second
+
+func (s CheckStatus) String() string {
+	switch s {
+	case CheckRunning:
+		return "running"
+	case CheckOK:
+		return "ok"
+	case CheckAuthFailed:
+		return "auth-failed"
+	case CheckTimeout:
+		return "timeout"
+	case CheckUnreachable:
+		return "unreachable"
+	case CheckHostKeyChanged:
+		return "host-key-changed"
+	case CheckDNSFailed:
+		return "dns-failed"
+	case CheckRefused:
+		return "refused"
+	case CheckJumpFailed:
+		return "jump-failed"
+	case CheckFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// glyph returns the list marker for the status and the theme markup color
+// it is drawn in.
+func (s CheckStatus) glyph(theme AppTheme) (string, string) {
+	switch s {
+	case CheckRunning:
+		return "◌", mutedMarkup(theme)
+	case CheckOK:
+		return "●", theme.MarkupSuccess
+	case CheckAuthFailed:
+		return "◆", theme.MarkupWarning
+	case CheckTimeout:
+		return "○", theme.MarkupWarning
+	case CheckUnreachable:
+		return "✕", theme.MarkupError
+	case CheckHostKeyChanged:
+		return "▲", theme.MarkupError
+	case CheckDNSFailed:
+		return "?", theme.MarkupError
+	case CheckRefused:
+		return "⊘", theme.MarkupError
+	case CheckJumpFailed:
+		return "↯", theme.MarkupError
+	case CheckFailed:
+		return "!", theme.MarkupWarning
+	default:
+		return " ", mutedMarkup(theme)
+	}
+}
+
+// mutedMarkup is the theme's muted color as a tview color tag.
+func mutedMarkup(theme AppTheme) string {
+	return fmt.Sprintf("#%06x", theme.Muted.Hex())
+}
+
+// FailureKind is the cause of a failed connection test, derived from ssh's
+// stderr and exit code.
+type FailureKind string
+
+const (
+	FailureNone     FailureKind = ""
+	FailureDNS      FailureKind = "dns"
+	FailureRefused  FailureKind = "refused"
+	FailureTimeout  FailureKind = "timeout"
+	FailureAuth     FailureKind = "permission-denied"
+	FailureHostKey  FailureKind = "host-key"
+	FailureJumpHost FailureKind = "jump-host"
+	FailureUnknown  FailureKind = "unknown"
+)
+
+// checkOutputLines is how much of ssh's stderr is kept with a result.
+const checkOutputLines = 20
+
+// CheckResult is the last connection test of a host. Output holds the last
+// lines ssh wrote to stderr.
+type CheckResult struct {
+	Status      CheckStatus `json:"status"`
+	Failure     FailureKind `json:"failure,omitempty"`
+	Summary     string      `json:"summary,omitempty"`
+	AuthMethods []string    `json:"auth_methods,omitempty"`
+	ExitCode    int         `json:"exit_code"`
+	Output      []string    `json:"output,omitempty"`
+	CheckedAt   time.Time   `json:"checked_at"`
+	Duration    Duration    `json:"duration"`
+	Connect     Duration    `json:"connect,omitempty"`
+	Hops        []HopTiming `json:"hops,omitempty"`
+}
+
+// Duration stores a time.Duration as its string form in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (s CheckStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *CheckStatus) UnmarshalText(text []byte) error {
+	for candidate := CheckUnknown; candidate <= CheckFailed; candidate++ {
+		if candidate.String() == string(text) {
+			*s = candidate
+			return nil
+		}
+	}
+	*s = CheckUnknown
+	return nil
+}
+
+// sshCheckArgs is the non-interactive connection test, also documented in the
+// README. -v adds the messages connection timings are read from.
+func sshCheckArgs(alias string) []string {
+	return []string{
+		"-v",
+		"-o", "ConnectTimeout=5",
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=accept-new",
+		alias,
+		"exit", "0",
+	}
+}
+
+// runSSHCheck tests one alias. Cancelling ctx kills the ssh process.
+func runSSHCheck(ctx context.Context, alias string) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	stderr := &stderrRecorder{start: start}
+	cmd := exec.CommandContext(ctx, "ssh", sshCheckArgs(alias)...)
+	cmd.Stderr = stderr
+	// Don't wait on stderr held open by children of a killed ssh.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	result := CheckResult{
+		CheckedAt: start,
+		Duration:  Duration(time.Since(start)),
+	}
+	lines := stderr.Lines()
+	connect, hops := connectionTimings(lines)
+	result.Connect = Duration(connect)
+	result.Hops = hops
+	for _, line := range lines {
+		if line.Text != "" && !isVerboseLine(line.Text) {
+			result.Output = append(result.Output, line.Text)
+		}
+	}
+	if len(result.Output) > checkOutputLines {
+		result.Output = result.Output[len(result.Output)-checkOutputLines:]
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Status = CheckOK
+		return result
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.ExitCode = -1
+		result.Failure = FailureTimeout
+		result.Summary = fmt.Sprintf("no answer within %s", checkTimeout)
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Failure, result.Summary, result.AuthMethods = diagnoseSSHFailure(result.Output, result.ExitCode)
+	default:
+		result.ExitCode = -1
+		result.Failure = FailureUnknown
+		result.Summary = err.Error()
+	}
+	result.Status = result.Failure.status()
+	return result
+}
+
+// status folds a failure cause into the list status.
+func (kind FailureKind) status() CheckStatus {
+	switch kind {
+	case FailureNone:
+		return CheckOK
+	case FailureTimeout:
+		return CheckTimeout
+	case FailureAuth:
+		return CheckAuthFailed
+	case FailureHostKey:
+		return CheckHostKeyChanged
+	case FailureDNS:
+		return CheckDNSFailed
+	case FailureRefused:
+		return CheckRefused
+	case FailureJumpHost:
+		return CheckJumpFailed
+	default:
+		return CheckFailed
+	}
+}
+
+var authMethodsPattern = regexp.MustCompile(`(?i)permission denied \(([^)]*)\)`)
+
+// diagnoseSSHFailure maps ssh's stderr lines and exit code to a failure
+// cause, a one-line summary and, for authentication failures, the methods
+// the server offered.
+func diagnoseSSHFailure(output []string, exitCode int) (FailureKind, string, []string) {
+	if exitCode < 0 {
+		// -1 means ssh was killed by a signal it didn't send itself, so
+		// there is no telling whether it ever connected.
+		return FailureUnknown, "ssh was killed by a signal", nil
+	}
+	if exitCode != 255 {
+		// ssh itself exits 255 on errors; anything else came from the remote
+		// command, so the connection worked. Forced commands, as on git
+		// hosts, refuse "exit 0" this way.
+		return FailureNone, fmt.Sprintf("connected; remote command exited %d", exitCode), nil
+	}
+
+	text := strings.ToLower(strings.Join(output, "\n"))
+	cause := firstErrorLine(output)
+	has := func(needles ...string) bool {
+		for _, needle := range needles {
+			if strings.Contains(text, needle) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A failed ProxyJump hop closes the forwarded stdio channel; whatever the
+	// hop reported is the useful part of the summary.
+	if has("stdio forwarding failed", "unknown port 65535", "channel 0: open failed") {
+		return FailureJumpHost, "jump host failed: " + cause, nil
+	}
+
+	switch {
+	case has("remote host identification has changed"):
+		return FailureHostKey, "host key changed since it was recorded in known_hosts", nil
+	case has("host key verification failed"):
+		return FailureHostKey, "host key verification failed", nil
+	case has("permission denied", "too many authentication failures"):
+		var methods []string
+		if m := authMethodsPattern.FindStringSubmatch(strings.Join(output, "\n")); m != nil {
+			for _, method := range strings.Split(m[1], ",") {
+				if method = strings.TrimSpace(method); method != "" {
+					methods = append(methods, method)
+				}
+			}
+		}
+		summary := "permission denied"
+		if len(methods) > 0 {
+			summary += " (tried " + strings.Join(methods, ", ") + ")"
+		}
+		return FailureAuth, summary, methods
+	case has("could not resolve hostname", "name or service not known", "nodename nor servname", "temporary failure in name resolution"):
+		return FailureDNS, cause, nil
+	case has("connection refused"):
+		return FailureRefused, cause, nil
+	case has("timed out"):
+		return FailureTimeout, cause, nil
+	}
+	if cause == "" {
+		cause = fmt.Sprintf("ssh exited %d", exitCode)
+	}
+	return FailureUnknown, cause, nil
+}
+
+// firstErrorLine returns the first stderr line that isn't an informational
+// warning, without ssh's "ssh: " prefix.
+func firstErrorLine(output []string) string {
+	for _, line := range output {
+		if strings.HasPrefix(line, "Warning: Permanently added") {
+			continue
+		}
+		return strings.TrimPrefix(line, "ssh: ")
+	}
+	return ""
+}
+
+// checkAliases tests aliases through a pool of at most workers goroutines and
+// calls onResult from those goroutines as each test finishes. It returns when
+// all tests are done or ctx is cancelled.
+func checkAliases(ctx context.Context, aliases []string, workers int, onResult func(alias string, result CheckResult)) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for alias := range jobs {
+				result := runSSHCheck(ctx, alias)
+				if ctx.Err() != nil {
+					return
+				}
+				onResult(alias, result)
+			}
+		}()
+	}
+feed:
+	for _, alias := range aliases {
+		select {
+		case jobs <- alias:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// checkTargets returns the concrete aliases of entries, skipping Match
+// blocks, wildcard patterns and duplicates.
+func checkTargets(entries []HostEntry) []string {
+	seen := map[string]bool{}
+	aliases := []string{}
+	for _, entry := range entries {
+		if entry.IsMatch() || len(entry.Patterns) == 0 {
+			continue
+		}
+		alias := entry.Patterns[0]
+		if strings.ContainsAny(alias, "*?!") || seen[alias] {
+			continue
+		}
+		seen[alias] = true
+		aliases = append(aliases, alias)
+	}
+	return aliases
+}
+
+// checkAllVisible runs the bulk check over the filtered hosts, or only the
+// hosts of the group under the cursor, or cancels the one in progress.
+func (state *AppState) checkAllVisible() {
+	if state.CheckCancel != nil {
+		state.CheckCancel()
+		return
+	}
+
+	targets := state.Filtered
+	if group, ok := state.selectedGroup(); ok {
+		targets = nil
+		for _, i := range state.groupEntries(group) {
+			targets = append(targets, state.Filtered[i])
+		}
+	}
+	aliases := checkTargets(targets)
+	if len(aliases) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	state.CheckCancel = cancel
+
+	// Hosts the run doesn't reach keep their earlier result.
+	previous := map[string]CheckResult{}
+	for _, alias := range aliases {
+		previous[alias] = state.Checks[alias]
+		state.setCheckResult(alias, CheckResult{Status: CheckRunning})
+	}
+	done, failed := 0, 0
+	total := len(aliases)
+	theme := state.currentTheme()
+	state.setStatus(theme.MarkupAccent, fmt.Sprintf("Checking 0/%d  (P to cancel)", total))
+
+	go func() {
+		checkAliases(ctx, aliases, checkWorkers, func(alias string, result CheckResult) {
+			state.App.QueueUpdateDraw(func() {
+				done++
+				if result.Status != CheckOK {
+					failed++
+				}
+				state.setCheckResult(alias, result)
+				appendLatency(state.Latency, alias, result)
+				state.setStatus(theme.MarkupAccent, fmt.Sprintf("Checking %d/%d  %d ok  %d failed  (P to cancel)", done, total, done-failed, failed))
+			})
+		})
+		cancelled := ctx.Err() != nil
+		cancel()
+		state.App.QueueUpdateDraw(func() {
+			state.CheckCancel = nil
+			for _, alias := range aliases {
+				if state.Checks[alias].Status == CheckRunning {
+					state.setCheckResult(alias, previous[alias])
+				}
+			}
+			state.saveChecks()
+			state.saveLatency()
+			state.showRow(state.HostList.GetCurrentItem())
+			summary := fmt.Sprintf("Checked %d/%d  %d ok  %d failed", done, total, done-failed, failed)
+			color := theme.MarkupSuccess
+			if cancelled {
+				summary += "  (cancelled)"
+				color = theme.MarkupWarning
+			} else if failed > 0 {
+				color = theme.MarkupError
+			}
+			state.setStatus(color, summary)
+		})
+	}()
+}
+
+// setCheckResult stores a result and redraws every list row for the alias.
+func (state *AppState) setCheckResult(alias string, result CheckResult) {
+	if state.Checks == nil {
+		state.Checks = map[string]CheckResult{}
+	}
+	if result.Status == CheckUnknown {
+		delete(state.Checks, alias)
+	} else {
+		state.Checks[alias] = result
+	}
+	for i, entry := range state.Filtered {
+		if !entry.IsMatch() && len(entry.Patterns) > 0 && entry.Patterns[0] == alias {
+			state.refreshListItem(i)
+		}
+	}
+}
+
+// refreshListItem redraws one row of the host list.
+func (state *AppState) refreshListItem(index int) {
+	row := state.rowOf(index)
+	if index < 0 || index >= len(state.Filtered) || row < 0 || row >= state.HostList.GetItemCount() {
+		return
+	}
+	state.HostList.SetItemText(row, state.listItemText(index), "")
+}
+
+// showCheckResultModal shows the last check of alias with its cause. The raw
+// ssh output starts collapsed; o toggles it.
+func (state *AppState) showCheckResultModal(alias string) {
+	result, ok := state.Checks[alias]
+	if !ok || result.Status == CheckRunning {
+		state.showMessageModal("No Check", fmt.Sprintf("%s has not been checked yet.\nPress p to test it.", alias))
+		return
+	}
+	state.ThemeModalOpen = true
+	state.App.EnableMouse(false)
+
+	theme := state.currentTheme()
+	glyph, color := result.Status.glyph(theme)
+
+	modalBox := tview.NewFlex().SetDirection(tview.FlexRow)
+	modalBox.SetBorder(true)
+	modalBox.SetTitle(fmt.Sprintf(" Check: %s ", tview.Escape(alias)))
+	modalBox.SetTitleAlign(tview.AlignCenter)
+	modalBox.SetBackgroundColor(theme.PanelBg)
+	modalBox.SetBorderColor(theme.Border)
+	modalBox.SetTitleColor(theme.Text)
+
+	lines := []string{
+		fmt.Sprintf("[%s]%s %s[-]  %s", color, glyph, result.Status, time.Duration(result.Duration).Round(time.Millisecond)),
+	}
+	if result.Failure != FailureNone {
+		lines = append(lines,
+			fmt.Sprintf("Cause: %s", result.Failure),
+			tview.Escape(result.Summary),
+		)
+		if result.ExitCode >= 0 {
+			lines = append(lines, fmt.Sprintf("Exit status: %d", result.ExitCode))
+		}
+	} else if result.Summary != "" {
+		lines = append(lines, tview.Escape(result.Summary))
+	}
+	if result.Connect > 0 {
+		lines = append(lines, fmt.Sprintf("TCP connect: %s", time.Duration(result.Connect).Round(time.Millisecond)))
+	}
+	if len(result.Hops) > 1 {
+		lines = append(lines, "Hops: "+hopsText(result.Hops, theme.MarkupWarning))
+	}
+	lines = append(lines, "Checked "+result.CheckedAt.Format("2006-01-02 15:04:05"))
+	summary := strings.Join(lines, "\n")
+
+	msgText := tview.NewTextView()
+	msgText.SetDynamicColors(true)
+	msgText.SetWrap(true)
+	msgText.SetBackgroundColor(theme.PanelBg)
+	msgText.SetTextColor(theme.Text)
+	msgText.SetBorderPadding(1, 0, 2, 2)
+
+	footerText := tview.NewTextView()
+	footerText.SetTextAlign(tview.AlignCenter)
+	footerText.SetTextColor(theme.Muted)
+	footerText.SetBackgroundColor(theme.PanelBg)
+
+	modalBox.AddItem(msgText, 0, 1, false)
+	modalBox.AddItem(footerText, 1, 0, false)
+
+	modalWidth := 76
+	// Rows the text needs once wrapped inside the border and padding.
+	textWidth := modalWidth - 6
+	wrapped := func(lines []string) int {
+		n := 0
+		for _, line := range lines {
+			n += 1 + (tview.TaggedStringWidth(line)-1)/textWidth
+		}
+		return n
+	}
+	collapsedHeight := wrapped(lines) + 5
+	expandedHeight := collapsedHeight + wrapped(result.Output) + 1
+	if expandedHeight > 30 {
+		expandedHeight = 30
+	}
+	row := tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(nil, 0, 1, false).
+		AddItem(modalBox, modalWidth, 0, true).
+		AddItem(nil, 0, 1, false)
+	modalFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(row, collapsedHeight, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	expanded := false
+	render := func() {
+		text := summary
+		hint := "Esc close"
+		if len(result.Output) > 0 {
+			if expanded {
+				text += "\n\n[::d]" + tview.Escape(strings.Join(result.Output, "\n")) + "[::-]"
+				hint = "o hide output  ↑/↓ scroll  Esc close"
+				modalFlex.ResizeItem(row, expandedHeight, 0)
+			} else {
+				hint = fmt.Sprintf("o show ssh output (%d lines)  Esc close", len(result.Output))
+				modalFlex.ResizeItem(row, collapsedHeight, 0)
+			}
+		}
+		msgText.SetText(text)
+		footerText.SetText(hint)
+	}
+	render()
+
+	closeModal := func() {
+		state.App.EnableMouse(true)
+		state.Pages.RemovePage("check-modal")
+		state.ThemeModalOpen = false
+		state.App.SetFocus(state.HostList)
+	}
+
+	modalBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Rune() == 'o' && len(result.Output) > 0:
+			expanded = !expanded
+			render()
+		case event.Key() == tcell.KeyUp || event.Key() == tcell.KeyDown:
+			row, col := msgText.GetScrollOffset()
+			if event.Key() == tcell.KeyUp && row > 0 {
+				row--
+			} else if event.Key() == tcell.KeyDown {
+				row++
+			}
+			msgText.ScrollTo(row, col)
+		default:
+			closeModal()
+		}
+		return nil
+	})
+
+	state.Pages.AddPage("check-modal", modalFlex, true, true)
+	state.App.SetFocus(modalBox)
+}
+
+// checkSummary is the one-line last check shown in the Details panel.
+func (state *AppState) checkSummary(result CheckResult) string {
+	glyph, color := result.Status.glyph(state.currentTheme())
+	text := fmt.Sprintf("[%s]%s %s[-]  %s  (%s)", color, glyph, result.Status,
+		result.CheckedAt.Format(time.RFC3339), time.Duration(result.Duration).Round(time.Millisecond))
+	if result.Summary != "" {
+		text += "  " + tview.Escape(result.Summary)
+	}
+	return text
+}
+
+func getCheckLogPath() string {
+	configPath := getAppConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "checks.json")
+}
+
+// loadCheckLog reads the stored last check per alias.
+func loadCheckLog() map[string]CheckResult {
+	results := map[string]CheckResult{}
+	path := getCheckLogPath()
+	if path == "" {
+		return results
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return results
+	}
+	_ = json.Unmarshal(data, &results)
+	return results
+}
+
+func saveCheckLog(results map[string]CheckResult) error {
+	path := getCheckLogPath()
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	stored := map[string]CheckResult{}
+	for alias, result := range results {
+		if result.Status != CheckRunning && result.Status != CheckUnknown {
+			stored[alias] = result
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (state *AppState) loadChecks() {
+	state.Checks = loadCheckLog()
+}
+
+func (state *AppState) saveChecks() {
+	_ = saveCheckLog(state.Checks)
+}
+
+// listItemText is the host list label for Filtered[index], prefixed with the
+// last check status once any host has been checked, marked when pinned and
+// indented when the list is grouped. Characters matching the
+// search are accented, or bold and underlined on the selected row, whose
+// background is the accent colour.
+func (state *AppState) listItemText(index int) string {
+	entry := state.Filtered[index]
+	mainText, _ := entry.DisplayText()
+	openTag, closeTag := fmt.Sprintf("[%s]", state.currentTheme().MarkupAccent), "[-]"
+	if index == state.CurrentIndex {
+		openTag, closeTag = "[::bu]", "[::BU]"
+	}
+	mainText = highlightMatches(mainText, state.Query.fuzzyWords(), openTag, closeTag)
+	if state.isPinned(entry) {
+		mainText = "★ " + mainText
+	}
+	indent := ""
+	if state.Config.GroupBy != groupNone {
+		// Hosts sit under their group header
+		indent = "  "
+	}
+	if len(state.Checks) == 0 {
+		return indent + mainText
+	}
+	status := CheckUnknown
+	if !entry.IsMatch() && len(entry.Patterns) > 0 {
+		status = state.Checks[entry.Patterns[0]].Status
+	}
+	glyph, color := status.glyph(state.currentTheme())
+	return fmt.Sprintf("%s[%s]%s[-] %s", indent, color, glyph, mainText)
+}
+
+// handleCheck implements: 55h check [--all | alias...] [-j workers]
+func handleCheck(inv *cliInvocation) error {
+	all := inv.Has("all")
+	workers := checkWorkers
+	aliases := append([]string{}, inv.Args...)
+	configPath := inv.ConfigPath
+	if inv.Has("jobs") {
+		v, ok := parseIntVal(inv.Value("jobs"))
+		if !ok || *v < 1 {
+			return fmt.Errorf("--jobs must be a positive number")
+		}
+		workers = *v
+	}
+	if all {
+		entries, err := loadSSHConfig(configPath)
+		if err != nil {
+			return err
+		}
+		aliases = append(aliases, checkTargets(entries)...)
+	}
+	// Each host is tested once, in the order first given
+	seen := map[string]bool{}
+	unique := aliases[:0]
+	for _, alias := range aliases {
+		if !seen[alias] {
+			seen[alias] = true
+			unique = append(unique, alias)
+		}
+	}
+	aliases = unique
+	if len(aliases) == 0 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	width := 0
+	for _, a := range aliases {
+		if len(a) > width {
+			width = len(a)
+		}
+	}
+	var mu sync.Mutex
+	failed := 0
+	results := map[string]CheckResult{}
+	checkAliases(ctx, aliases, workers, func(alias string, result CheckResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Status != CheckOK {
+			failed++
+		}
+		note := result.Summary
+		if result.Status == CheckOK && result.Connect > 0 {
+			note = strings.TrimSuffix(fmt.Sprintf("tcp %s  %s", time.Duration(result.Connect).Round(time.Millisecond), result.Summary), "  ")
+		}
+		line := fmt.Sprintf("%-*s  %-16s  %8s  %s", width, alias, result.Status, time.Duration(result.Duration).Round(time.Millisecond), note)
+		fmt.Println(strings.TrimRight(line, " "))
+		results[alias] = result
+	})
+	if len(results) > 0 {
+		stored := loadCheckLog()
+		history := loadLatencyLog()
+		for alias, result := range results {
+			stored[alias] = result
+			appendLatency(history, alias, result)
+		}
+		if err := saveCheckLog(stored); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save check results: %v\n", err)
+		}
+		if err := saveLatencyLog(history); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not save latency history: %v\n", err)
+		}
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("cancelled")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d hosts failed", failed, len(aliases))
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// The outputs are stderr from real ssh runs, with the debug lines that
+// checkSSHConnection filters out already removed.
+func TestDiagnoseSSHFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   []string
+		exitCode int
+		kind     FailureKind
+		summary  string
+		methods  []string
+	}{
+		{
+			name:     "dns linux",
+			output:   []string{"ssh: Could not resolve hostname nosuch.example: Name or service not known"},
+			exitCode: 255,
+			kind:     FailureDNS,
+			summary:  "Could not resolve hostname nosuch.example: Name or service not known",
+		},
+		{
+			name:     "dns macos",
+			output:   []string{"ssh: Could not resolve hostname nosuch: nodename nor servname provided, or not known"},
+			exitCode: 255,
+			kind:     FailureDNS,
+			summary:  "Could not resolve hostname nosuch: nodename nor servname provided, or not known",
+		},
+		{
+			name:     "dns temporary failure",
+			output:   []string{"ssh: Could not resolve hostname db1.internal: Temporary failure in name resolution"},
+			exitCode: 255,
+			kind:     FailureDNS,
+			summary:  "Could not resolve hostname db1.internal: Temporary failure in name resolution",
+		},
+		{
+			name:     "refused",
+			output:   []string{"ssh: connect to host 10.0.0.5 port 22: Connection refused"},
+			exitCode: 255,
+			kind:     FailureRefused,
+			summary:  "connect to host 10.0.0.5 port 22: Connection refused",
+		},
+		{
+			name:     "timeout linux",
+			output:   []string{"ssh: connect to host 10.0.0.5 port 22: Connection timed out"},
+			exitCode: 255,
+			kind:     FailureTimeout,
+			summary:  "connect to host 10.0.0.5 port 22: Connection timed out",
+		},
+		{
+			name:     "timeout macos",
+			output:   []string{"ssh: connect to host 10.0.0.5 port 22: Operation timed out"},
+			exitCode: 255,
+			kind:     FailureTimeout,
+			summary:  "connect to host 10.0.0.5 port 22: Operation timed out",
+		},
+		{
+			name:     "permission denied",
+			output:   []string{"deploy@10.0.0.5: Permission denied (publickey,password)."},
+			exitCode: 255,
+			kind:     FailureAuth,
+			summary:  "permission denied (tried publickey, password)",
+			methods:  []string{"publickey", "password"},
+		},
+		{
+			name: "permission denied after new host key",
+			output: []string{
+				"Warning: Permanently added 'github.com' (ED25519) to the list of known hosts.",
+				"git@github.com: Permission denied (publickey).",
+			},
+			exitCode: 255,
+			kind:     FailureAuth,
+			summary:  "permission denied (tried publickey)",
+			methods:  []string{"publickey"},
+		},
+		{
+			name:     "too many authentication failures",
+			output:   []string{"Received disconnect from 10.0.0.5 port 22:2: Too many authentication failures", "Disconnected from 10.0.0.5 port 22"},
+			exitCode: 255,
+			kind:     FailureAuth,
+			summary:  "permission denied",
+		},
+		{
+			name: "host key changed",
+			output: []string{
+				"@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@",
+				"@    WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!     @",
+				"@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@@",
+				"IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!",
+				"Offending ED25519 key in /home/me/.ssh/known_hosts:12",
+				"Host key for 10.0.0.5 has changed and you have requested strict checking.",
+				"Host key verification failed.",
+			},
+			exitCode: 255,
+			kind:     FailureHostKey,
+			summary:  "host key changed since it was recorded in known_hosts",
+		},
+		{
+			name:     "host key unknown",
+			output:   []string{"No ED25519 host key is known for 10.0.0.5 and you have requested strict checking.", "Host key verification failed."},
+			exitCode: 255,
+			kind:     FailureHostKey,
+			summary:  "host key verification failed",
+		},
+		{
+			name:     "jump host cannot reach target",
+			output:   []string{"channel 0: open failed: connect failed: Name or service not known", "stdio forwarding failed", "kex_exchange_identification: Connection closed by remote host", "Connection closed by UNKNOWN port 65535"},
+			exitCode: 255,
+			kind:     FailureJumpHost,
+			summary:  "jump host failed: channel 0: open failed: connect failed: Name or service not known",
+		},
+		{
+			name:     "jump host unresolvable",
+			output:   []string{"ssh: Could not resolve hostname bastoin: Name or service not known", "Connection closed by UNKNOWN port 65535"},
+			exitCode: 255,
+			kind:     FailureJumpHost,
+			summary:  "jump host failed: Could not resolve hostname bastoin: Name or service not known",
+		},
+		{
+			name:     "connection reset",
+			output:   []string{"kex_exchange_identification: read: Connection reset by peer", "Connection reset by 10.0.0.5 port 22"},
+			exitCode: 255,
+			kind:     FailureUnknown,
+			summary:  "kex_exchange_identification: read: Connection reset by peer",
+		},
+		{
+			name:     "no output",
+			exitCode: 255,
+			kind:     FailureUnknown,
+			summary:  "ssh exited 255",
+		},
+		{
+			name:     "remote command failed",
+			output:   []string{"PTY allocation request failed on channel 0"},
+			exitCode: 1,
+			kind:     FailureNone,
+			summary:  "connected; remote command exited 1",
+		},
+		{
+			name:     "ssh killed by a signal",
+			output:   []string{"Warning: Permanently added '10.0.0.5' (ED25519) to the list of known hosts."},
+			exitCode: -1,
+			kind:     FailureUnknown,
+			summary:  "ssh was killed by a signal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, summary, methods := diagnoseSSHFailure(tt.output, tt.exitCode)
+			if kind != tt.kind || summary != tt.summary || !reflect.DeepEqual(methods, tt.methods) {
+				t.Errorf("diagnoseSSHFailure() = %q, %q, %q\nwant %q, %q, %q", kind, summary, methods, tt.kind, tt.summary, tt.methods)
+			}
+		})
+	}
+}
+
+func TestFailureKindStatus(t *testing.T) {
+	tests := []struct {
+		kind FailureKind
+		want string
+	}{
+		{FailureNone, "ok"},
+		{FailureDNS, "dns-failed"},
+		{FailureRefused, "refused"},
+		{FailureJumpHost, "jump-failed"},
+		{FailureTimeout, "timeout"},
+		{FailureAuth, "auth-failed"},
+		{FailureHostKey, "host-key-changed"},
+		{FailureUnknown, "failed"},
+	}
+	for _, tt := range tests {
+		status := tt.kind.status()
+		if status.String() != tt.want {
+			t.Errorf("%q.status() = %s, want %s", tt.kind, status, tt.want)
+		}
+		var read CheckStatus
+		if err := read.UnmarshalText([]byte(status.String())); err != nil || read != status {
+			t.Errorf("%s does not read back: got %s, %v", status, read, err)
+		}
+	}
+	// Results stored before the causes were told apart
+	var old CheckStatus
+	_ = old.UnmarshalText([]byte("unreachable"))
+	if old != CheckUnreachable {
+		t.Errorf("unreachable reads as %s", old)
+	}
+}
@@ -0,0 +1,828 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cliFlag describes one flag of a subcommand. Flags without Arg are
+// booleans; the others take a value as "--name value", "--name=value" or
+// "-s value".
+type cliFlag struct {
+	Name   string
+	Short  string
+	Arg    string
+	Usage  string
+	Repeat bool
+	// Values restricts and completes the flag's value.
+	Values []string
+}
+
+// cliCommand is a node of the command tree. Groups such as "add" have
+// Commands and no Run.
+type cliCommand struct {
+	Name        string
+	Aliases     []string
+	Args        string
+	Summary     string
+	Description string
+	Flags       []cliFlag
+	// CompleteAliases completes positional arguments with host aliases;
+	// ArgValues completes them from a fixed list.
+	CompleteAliases bool
+	ArgValues       []string
+	Hidden          bool
+	// QueryArgs keeps unknown "-words" as arguments, for search queries
+	// such as -host:legacy*.
+	QueryArgs bool
+	Commands  []*cliCommand
+	Run       func(inv *cliInvocation) error
+
+	parent *cliCommand
+}
+
+// cliInvocation is a parsed command line.
+type cliInvocation struct {
+	Command    *cliCommand
+	ConfigPath string
+	Args       []string
+	// Passthrough holds everything after "--".
+	Passthrough []string
+	values      map[string][]string
+}
+
+func (inv *cliInvocation) Has(name string) bool {
+	return len(inv.values[name]) > 0
+}
+
+// Value returns the last value given for a flag.
+func (inv *cliInvocation) Value(name string) string {
+	values := inv.values[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+func (inv *cliInvocation) Values(name string) []string {
+	return inv.values[name]
+}
+
+// Path is the command as typed, e.g. "55h add ssh".
+func (cmd *cliCommand) Path() string {
+	if cmd.parent == nil {
+		return cmd.Name
+	}
+	return cmd.parent.Path() + " " + cmd.Name
+}
+
+func (cmd *cliCommand) find(name string) *cliCommand {
+	for _, sub := range cmd.Commands {
+		if sub.Name == name {
+			return sub
+		}
+		for _, alias := range sub.Aliases {
+			if alias == name {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+func (cmd *cliCommand) flag(name string, long bool) *cliFlag {
+	for i := range cmd.Flags {
+		f := &cmd.Flags[i]
+		if long && f.Name == name || !long && f.Short != "" && f.Short == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// visibleCommands are the subcommands shown in help and completions.
+func (cmd *cliCommand) visibleCommands() []*cliCommand {
+	visible := []*cliCommand{}
+	for _, sub := range cmd.Commands {
+		if !sub.Hidden {
+			visible = append(visible, sub)
+		}
+	}
+	return visible
+}
+
+var dryRunFlag = cliFlag{Name: "dry-run", Short: "n", Usage: "Print the diff without writing"}
+
+// atFlag picks one definition of an alias that several Host lines list.
+var atFlag = cliFlag{Name: "at", Arg: "file:line", Usage: "Use the definition whose Host line is at file:line when the alias is defined more than once"}
+
+// cliRoot is the 55h command tree. Bare "55h" opens the TUI. It is built
+// in init because some commands walk the tree themselves.
+var cliRoot *cliCommand
+
+func init() {
+	cliRoot = newCLIRoot()
+}
+
+func newCLIRoot() *cliCommand {
+	root := &cliCommand{
+		Name:        "55h",
+		Summary:     "terminal-first SSH host manager",
+		Description: "Browse, search, test and edit the hosts of ~/.ssh/config, following every Include. Without a command 55h opens the interactive host browser.",
+		Commands: []*cliCommand{
+			{
+				Name:            "connect",
+				Args:            "<query...> [-- command...]",
+				Summary:         "Connect to the host a fuzzy query selects",
+				Description:     "Connects right away when the query matches one host (or names an alias exactly) and opens the host browser filtered by the query when it matches several. Words after -- are run on the host as a remote command. \"55h <query>\" is a shortcut for this command.",
+				CompleteAliases: true,
+				QueryArgs:       true,
+				Run:             handleConnect,
+			},
+			{
+				Name:    "add",
+				Summary: "Add a host",
+				Commands: []*cliCommand{{
+					Name:        "ssh",
+					Args:        "[user@]host",
+					Summary:     "Add a Host block for user@host",
+					Description: "Appends a Host block to the main config, or to the file given by --file or add_file in config.yml. Without --name the alias is asked for on a terminal, suggesting user@host. With --from the block starts as a copy of every directive of another host, written right after it; host and the other flags then replace copied values and may be left out.",
+					Flags: []cliFlag{
+						{Name: "from", Arg: "alias", Usage: "Copy the block of this host; the alias suggestion counts up its number"},
+						{Name: "file", Short: "f", Arg: "path", Usage: "File to add to; it must be reached by an Include (relative to the main config's directory)"},
+						{Name: "port", Short: "p", Arg: "port", Usage: "Port"},
+						{Name: "identity", Short: "i", Arg: "file", Usage: "IdentityFile"},
+						{Name: "jump", Short: "J", Arg: "hosts", Usage: "ProxyJump"},
+						{Name: "option", Short: "o", Arg: "Key=Value", Usage: "Any other ssh_config option", Repeat: true},
+						{Name: "name", Arg: "alias", Usage: "Host alias"},
+					},
+					Run: handleAddSSH,
+				}},
+			},
+			{
+				Name:        "list",
+				Aliases:     []string{"ls"},
+				Args:        "[query...]",
+				Summary:     "List hosts as a table, JSON, JSON Lines, CSV or YAML",
+				Description: "Lists every Host in config order, or the order given by --sort, filtered by a query in the search box syntax (fuzzy words, field:value, -negation, \"phrases\", /regex/, OR).",
+				Flags: []cliFlag{
+					{Name: "sort", Short: "s", Arg: "mode", Usage: "Order like the host browser's sort modes (default config)", Values: sortModes},
+					{Name: "fields", Short: "f", Arg: "list", Usage: "Comma-separated fields, or \"all\" (" + strings.Join(listFields, ", ") + ", or any ssh_config keyword)"},
+					{Name: "output", Short: "o", Arg: "format", Usage: "Output format (default table)", Values: listFormats},
+				},
+				QueryArgs: true,
+				Run:       handleList,
+			},
+			{
+				Name:            "check",
+				Args:            "[alias...]",
+				Summary:         "Test connections in parallel",
+				Description:     "Runs the non-interactive connection test for each alias, or every concrete Host with --all, and exits non-zero if any fails. Results are stored for the host browser and 55h list.",
+				CompleteAliases: true,
+				Flags: []cliFlag{
+					{Name: "all", Short: "a", Usage: "Check every concrete Host"},
+					{Name: "jobs", Short: "j", Arg: "n", Usage: fmt.Sprintf("Tests to run at once (default %d)", checkWorkers)},
+				},
+				Run: handleCheck,
+			},
+			{
+				Name:        "graph",
+				Summary:     "Print the ProxyJump topology",
+				Description: "Prints how every concrete Host is reached, starting from the local machine. Cycles and undefined aliases are reported on stderr.",
+				Flags: []cliFlag{
+					{Name: "dot", Usage: "Print Graphviz DOT"},
+					{Name: "text", Usage: "Print a text tree (default)"},
+				},
+				Run: handleGraph,
+			},
+			{
+				Name:            "rm",
+				Aliases:         []string{"remove"},
+				Args:            "<alias>",
+				Summary:         "Delete a host",
+				Description:     "Deletes the host block like d in the host browser. When the Host line lists other patterns too, only the alias is removed from it unless --block is given. Asks for confirmation on a terminal; scripts must pass --yes.",
+				CompleteAliases: true,
+				Flags: []cliFlag{
+					{Name: "block", Short: "b", Usage: "Remove the whole block even if its Host line lists other patterns"},
+					{Name: "yes", Short: "y", Usage: "Delete without asking"},
+					atFlag,
+					dryRunFlag,
+				},
+				Run: handleRemove,
+			},
+			{
+				Name:            "set",
+				Aliases:         []string{"edit"},
+				Args:            "<alias> [Key=Value...]",
+				Summary:         "Set or unset options of a host",
+				Description:     "Edits a host like the form in the host browser. Repeat a multi-value key such as LocalForward to set all of its values. The keys tags, owner and note write the host's # 55h: metadata comment instead of an option.",
+				CompleteAliases: true,
+				Flags: []cliFlag{
+					{Name: "unset", Short: "u", Arg: "Key", Usage: "Remove every occurrence of an option", Repeat: true},
+					atFlag,
+					dryRunFlag,
+				},
+				Run: handleSet,
+			},
+			{
+				Name:            "rename",
+				Args:            "<old> <new>",
+				Summary:         "Rename a host alias",
+				Description:     "Renames the alias, rewrites ProxyJump hops that point to it in every loaded file and moves its stored history.",
+				CompleteAliases: true,
+				Flags:           []cliFlag{atFlag, dryRunFlag},
+				Run:             handleRename,
+			},
+			{
+				Name:            "mv",
+				Aliases:         []string{"move"},
+				Args:            "<alias> <file>",
+				Summary:         "Move a host to another config file",
+				Description:     "Moves the host block, with the comments above it, to the end of a file the main config reaches through Include, like m in the host browser. The file is created if needed; relative paths are taken from the main config's directory.",
+				CompleteAliases: true,
+				Flags: []cliFlag{
+					{Name: "copy", Short: "c", Usage: "Copy the block and keep the original"},
+					atFlag,
+					dryRunFlag,
+				},
+				Run: handleMove,
+			},
+			{
+				Name:    "backups",
+				Summary: "List or restore config backups",
+				Commands: []*cliCommand{
+					{
+						Name:        "list",
+						Aliases:     []string{"ls"},
+						Args:        "[file]",
+						Summary:     "List config backups, newest first",
+						Description: fmt.Sprintf("Lists the copies 55h keeps of a config file before each write, newest first. The last %d per file are kept.", backupKeep),
+						Run:         handleBackupsList,
+					},
+					{
+						Name:        "restore",
+						Args:        "<id>",
+						Summary:     "Restore a config file from a backup",
+						Description: "Writes a backup back to the file it was taken from. The current content is backed up first, so a restore can itself be restored. An ID prefix that matches one backup is enough.",
+						Flags: []cliFlag{
+							{Name: "yes", Short: "y", Usage: "Restore without asking"},
+							dryRunFlag,
+						},
+						Run: handleBackupsRestore,
+					},
+				},
+			},
+			{
+				Name:    "version",
+				Summary: "Print the version",
+				Run: func(inv *cliInvocation) error {
+					fmt.Println("55h " + versionLabel())
+					return nil
+				},
+			},
+			{
+				Name:        "completion",
+				Args:        "<bash|zsh|fish>",
+				Summary:     "Print a shell completion script",
+				Description: "Prints a completion script that completes commands, flags and, by calling back into 55h, host aliases.\n\n  bash: source <(55h completion bash)\n  zsh:  source <(55h completion zsh)\n  fish: 55h completion fish | source",
+				ArgValues:   []string{"bash", "zsh", "fish"},
+				Run:         handleCompletion,
+			},
+			{
+				Name:    "man",
+				Summary: "Print the man page (roff)",
+				Run: func(inv *cliInvocation) error {
+					writeManPage(os.Stdout, cliRoot)
+					return nil
+				},
+			},
+			{
+				Name:   "__complete",
+				Args:   "aliases",
+				Hidden: true,
+				Run:    handleComplete,
+			},
+		},
+	}
+	var link func(cmd *cliCommand)
+	link = func(cmd *cliCommand) {
+		for _, sub := range cmd.Commands {
+			sub.parent = cmd
+			link(sub)
+		}
+	}
+	link(root)
+	return root
+}
+
+// runCLI runs a subcommand and returns the exit code, or false when args
+// don't name one and the TUI should start.
+func runCLI(args []string, configPath string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	switch args[0] {
+	case "-h", "--help", "help":
+		if len(args) > 1 && args[0] == "help" {
+			return runCLI(append(args[1:], "--help"), configPath)
+		}
+		writeCommandHelp(os.Stdout, cliRoot)
+		return 0, true
+	case "--version":
+		fmt.Println("55h " + versionLabel())
+		return 0, true
+	}
+
+	cmd := cliRoot
+	for len(args) > 0 && len(cmd.Commands) > 0 {
+		sub := cmd.find(args[0])
+		if sub == nil {
+			break
+		}
+		cmd, args = sub, args[1:]
+	}
+	if cmd == cliRoot && !strings.HasPrefix(args[0], "-") {
+		// 55h <query> is short for 55h connect <query>
+		cmd = cliRoot.find("connect")
+	} else if cmd == cliRoot {
+		fmt.Fprintf(os.Stderr, "unknown command %q; run \"55h --help\" for a list of commands\n", args[0])
+		return 2, true
+	}
+
+	inv, help, err := parseCLIArgs(cmd, args)
+	if help || cmd.Run == nil {
+		writeCommandHelp(os.Stdout, cmd)
+		if cmd.Run == nil && !help {
+			return 2, true
+		}
+		return 0, true
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2, true
+	}
+	inv.ConfigPath = configPath
+	if err := cmd.Run(inv); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1, true
+	}
+	return 0, true
+}
+
+// parseCLIArgs splits args into flags and positional arguments. Flags may
+// appear anywhere before "--"; it also reports whether help was asked for.
+func parseCLIArgs(cmd *cliCommand, args []string) (*cliInvocation, bool, error) {
+	inv := &cliInvocation{Command: cmd, values: map[string][]string{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			inv.Passthrough = append([]string{}, args[i+1:]...)
+			break
+		}
+		if arg == "-h" || arg == "--help" {
+			return inv, true, nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			inv.Args = append(inv.Args, arg)
+			continue
+		}
+		long := strings.HasPrefix(arg, "--")
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		f := cmd.flag(name, long)
+		if f == nil && cmd.QueryArgs {
+			inv.Args = append(inv.Args, arg)
+			continue
+		}
+		if f == nil {
+			return nil, false, fmt.Errorf("unknown flag %s for %s; see %s --help", arg, cmd.Path(), cmd.Path())
+		}
+		if f.Arg == "" {
+			if hasValue {
+				return nil, false, fmt.Errorf("--%s does not take a value", f.Name)
+			}
+			inv.values[f.Name] = append(inv.values[f.Name], "true")
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, false, fmt.Errorf("--%s requires a value", f.Name)
+			}
+			value = args[i+1]
+			i++
+		}
+		if len(f.Values) > 0 && !containsString(f.Values, value) {
+			return nil, false, fmt.Errorf("--%s must be one of: %s", f.Name, strings.Join(f.Values, ", "))
+		}
+		if !f.Repeat {
+			inv.values[f.Name] = nil
+		}
+		inv.values[f.Name] = append(inv.values[f.Name], value)
+	}
+	return inv, false, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// flagLabel renders a flag for help text, e.g. "-o, --output <format>".
+func (f cliFlag) flagLabel() string {
+	label := "    --" + f.Name
+	if f.Short != "" {
+		label = "-" + f.Short + ", --" + f.Name
+	}
+	if f.Arg != "" {
+		label += " <" + f.Arg + ">"
+	}
+	return label
+}
+
+func (cmd *cliCommand) usageLine() string {
+	usage := cmd.Path()
+	if len(cmd.Commands) > 0 {
+		usage += " <command>"
+	}
+	if cmd.Args != "" {
+		usage += " " + cmd.Args
+	}
+	if len(cmd.Flags) > 0 {
+		usage += " [flags]"
+	}
+	return usage
+}
+
+func writeCommandHelp(w io.Writer, cmd *cliCommand) {
+	if cmd.parent == nil {
+		fmt.Fprintf(w, "55h %s - %s\n\nUsage:\n  55h\n  55h <query...> [-- command...]\n  55h <command> [flags]\n", versionLabel(), cmd.Summary)
+	} else {
+		fmt.Fprintf(w, "Usage: %s\n", cmd.usageLine())
+		if len(cmd.Aliases) > 0 {
+			fmt.Fprintf(w, "Aliases: %s\n", strings.Join(cmd.Aliases, ", "))
+		}
+	}
+	description := cmd.Description
+	if description == "" {
+		description = cmd.Summary
+	}
+	fmt.Fprintf(w, "\n%s\n", description)
+
+	if subs := cmd.visibleCommands(); len(subs) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		width := 0
+		for _, sub := range subs {
+			width = max(width, len(sub.Name))
+		}
+		for _, sub := range subs {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, sub.Name, sub.Summary)
+		}
+		fmt.Fprintf(w, "\nRun \"%s <command> --help\" for details.\n", cmd.Path())
+		return
+	}
+
+	flags := append(append([]cliFlag{}, cmd.Flags...), cliFlag{Name: "help", Short: "h", Usage: "Show this help"})
+	fmt.Fprintln(w, "\nFlags:")
+	width := 0
+	for _, f := range flags {
+		width = max(width, len(f.flagLabel()))
+	}
+	for _, f := range flags {
+		usage := f.Usage
+		if len(f.Values) > 0 {
+			usage += ": " + strings.Join(f.Values, ", ")
+		}
+		if f.Repeat {
+			usage += " (repeatable)"
+		}
+		fmt.Fprintf(w, "  %-*s  %s\n", width, f.flagLabel(), usage)
+	}
+}
+
+// handleComplete serves the dynamic part of the completion scripts.
+func handleComplete(inv *cliInvocation) error {
+	if len(inv.Args) != 1 || inv.Args[0] != "aliases" {
+		return fmt.Errorf("usage: 55h __complete aliases")
+	}
+	entries, err := loadSSHConfig(inv.ConfigPath)
+	if err != nil {
+		return nil
+	}
+	for _, alias := range checkTargets(entries) {
+		fmt.Println(alias)
+	}
+	return nil
+}
+
+func handleCompletion(inv *cliInvocation) error {
+	if len(inv.Args) != 1 {
+		return fmt.Errorf("usage: 55h completion <bash|zsh|fish>")
+	}
+	switch inv.Args[0] {
+	case "bash":
+		writeBashCompletion(os.Stdout, cliRoot)
+	case "zsh":
+		writeZshCompletion(os.Stdout, cliRoot)
+	case "fish":
+		writeFishCompletion(os.Stdout, cliRoot)
+	default:
+		return fmt.Errorf("unsupported shell %q (bash, zsh, fish)", inv.Args[0])
+	}
+	return nil
+}
+
+// leafCommands lists every runnable command with the words that select it,
+// e.g. {"add", "ssh"}.
+func leafCommands(cmd *cliCommand, words []string) [][]string {
+	leaves := [][]string{}
+	for _, sub := range cmd.visibleCommands() {
+		for _, name := range append([]string{sub.Name}, sub.Aliases...) {
+			path := append(append([]string{}, words...), name)
+			if len(sub.Commands) > 0 {
+				leaves = append(leaves, leafCommands(sub, path)...)
+			} else {
+				leaves = append(leaves, path)
+			}
+		}
+	}
+	return leaves
+}
+
+func commandAt(words []string) *cliCommand {
+	cmd := cliRoot
+	for _, word := range words {
+		cmd = cmd.find(word)
+	}
+	return cmd
+}
+
+func commandNames(cmd *cliCommand) []string {
+	names := []string{}
+	for _, sub := range cmd.visibleCommands() {
+		names = append(names, sub.Name)
+		names = append(names, sub.Aliases...)
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, root *cliCommand) {
+	fmt.Fprint(w, `# bash completion for 55h
+_55h_aliases() {
+    55h __complete aliases 2>/dev/null
+}
+
+_55h() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    COMPREPLY=()
+
+    if [[ $COMP_CWORD -eq 1 ]]; then
+`)
+	fmt.Fprintf(w, "        COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n        return\n    fi\n\n", strings.Join(commandNames(root), " "))
+	fmt.Fprint(w, "    local cmd=\"${COMP_WORDS[1]}\"\n    case \"$cmd\" in\n")
+	for _, sub := range root.visibleCommands() {
+		if len(sub.Commands) > 0 {
+			names := append([]string{sub.Name}, sub.Aliases...)
+			fmt.Fprintf(w, "    %s)\n        if [[ $COMP_CWORD -eq 2 ]]; then\n            COMPREPLY=( $(compgen -W %q -- \"$cur\") )\n            return\n        fi\n        cmd=\"$cmd ${COMP_WORDS[2]}\" ;;\n", strings.Join(names, "|"), strings.Join(commandNames(sub), " "))
+		}
+	}
+	fmt.Fprint(w, "    esac\n\n    local flags=\"\" args=\"\" aliases=0\n    case \"$cmd\" in\n")
+	for _, words := range leafCommands(root, nil) {
+		cmd := commandAt(words)
+		flags := []string{"--help"}
+		for _, f := range cmd.Flags {
+			flags = append(flags, "--"+f.Name)
+			if f.Short != "" {
+				flags = append(flags, "-"+f.Short)
+			}
+		}
+		fmt.Fprintf(w, "    %q)\n", strings.Join(words, " "))
+		for _, f := range cmd.Flags {
+			if len(f.Values) == 0 {
+				continue
+			}
+			pattern := "--" + f.Name
+			if f.Short != "" {
+				pattern = "-" + f.Short + "|" + pattern
+			}
+			fmt.Fprintf(w, "        case \"$prev\" in %s) COMPREPLY=( $(compgen -W %q -- \"$cur\") ); return ;; esac\n", pattern, strings.Join(f.Values, " "))
+		}
+		fmt.Fprintf(w, "        flags=%q", strings.Join(flags, " "))
+		if len(cmd.ArgValues) > 0 {
+			fmt.Fprintf(w, "; args=%q", strings.Join(cmd.ArgValues, " "))
+		}
+		if cmd.CompleteAliases {
+			fmt.Fprint(w, "; aliases=1")
+		}
+		fmt.Fprint(w, " ;;\n")
+	}
+	fmt.Fprint(w, `    esac
+
+    if [[ $cur == -* ]]; then
+        COMPREPLY=( $(compgen -W "$flags" -- "$cur") )
+    elif [[ $aliases -eq 1 ]]; then
+        COMPREPLY=( $(compgen -W "$(_55h_aliases)" -- "$cur") )
+    elif [[ -n $args ]]; then
+        COMPREPLY=( $(compgen -W "$args" -- "$cur") )
+    fi
+}
+
+complete -F _55h 55h
+`)
+}
+
+// zshQuote escapes text for a single-quoted zsh word inside _arguments
+// specs.
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, "'", `'\''`)
+	s = strings.ReplaceAll(s, "[", `\[`)
+	s = strings.ReplaceAll(s, "]", `\]`)
+	s = strings.ReplaceAll(s, ":", `\:`)
+	return s
+}
+
+func writeZshCompletion(w io.Writer, root *cliCommand) {
+	fmt.Fprint(w, "#compdef 55h\n\n_55h_aliases() {\n    local -a aliases\n    aliases=(${(f)\"$(55h __complete aliases 2>/dev/null)\"})\n    _describe 'host' aliases\n}\n\n")
+
+	var writeGroup func(cmd *cliCommand, fn string)
+	writeGroup = func(cmd *cliCommand, fn string) {
+		fmt.Fprintf(w, "%s() {\n    local -a commands\n    commands=(\n", fn)
+		for _, sub := range cmd.visibleCommands() {
+			for _, name := range append([]string{sub.Name}, sub.Aliases...) {
+				fmt.Fprintf(w, "        '%s:%s'\n", name, zshQuote(sub.Summary))
+			}
+		}
+		fmt.Fprint(w, "    )\n    if (( CURRENT == 2 )); then\n        _describe 'command' commands\n        return\n    fi\n    local cmd=${words[2]}\n    shift words\n    (( CURRENT-- ))\n    case $cmd in\n")
+		for _, sub := range cmd.visibleCommands() {
+			names := strings.Join(append([]string{sub.Name}, sub.Aliases...), "|")
+			if len(sub.Commands) > 0 {
+				subFn := fn + "_" + sub.Name
+				fmt.Fprintf(w, "        %s) %s ;;\n", names, subFn)
+				defer writeGroup(sub, subFn)
+				continue
+			}
+			specs := []string{"'(-h --help)'{-h,--help}'[Show help]'"}
+			for _, f := range sub.Flags {
+				spec := fmt.Sprintf("[%s]", zshQuote(f.Usage))
+				if f.Arg != "" {
+					action := ""
+					if len(f.Values) > 0 {
+						action = "(" + strings.Join(f.Values, " ") + ")"
+					}
+					spec += ":" + zshQuote(f.Arg) + ":" + action
+				}
+				prefix := ""
+				if f.Repeat {
+					prefix = "*"
+				}
+				if f.Short != "" {
+					specs = append(specs, fmt.Sprintf("%s'(-%s --%s)'{-%s,--%s}'%s'", prefix, f.Short, f.Name, f.Short, f.Name, spec))
+				} else {
+					specs = append(specs, fmt.Sprintf("%s'--%s%s'", prefix, f.Name, spec))
+				}
+			}
+			switch {
+			case sub.CompleteAliases:
+				specs = append(specs, "'*:host:_55h_aliases'")
+			case len(sub.ArgValues) > 0:
+				specs = append(specs, fmt.Sprintf("'1:value:(%s)'", strings.Join(sub.ArgValues, " ")))
+			}
+			fmt.Fprintf(w, "        %s)\n            _arguments -s \\\n                %s ;;\n", names, strings.Join(specs, " \\\n                "))
+		}
+		fmt.Fprint(w, "    esac\n}\n\n")
+	}
+	writeGroup(root, "_55h")
+	fmt.Fprint(w, "if [[ $zsh_eval_context[-1] == loadautofunc ]]; then\n    _55h \"$@\"\nelse\n    compdef _55h 55h\nfi\n")
+}
+
+func writeFishCompletion(w io.Writer, root *cliCommand) {
+	fmt.Fprint(w, "# fish completion for 55h\ncomplete -c 55h -f\n\n")
+	fishQuote := func(s string) string {
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+	}
+	top := strings.Join(commandNames(root), " ")
+	for _, sub := range root.visibleCommands() {
+		for _, name := range append([]string{sub.Name}, sub.Aliases...) {
+			fmt.Fprintf(w, "complete -c 55h -n 'not __fish_seen_subcommand_from %s' -a %s -d %s\n", top, name, fishQuote(sub.Summary))
+		}
+	}
+	for _, words := range leafCommands(root, nil) {
+		cmd := commandAt(words)
+		condition := "__fish_seen_subcommand_from " + words[0]
+		if len(words) > 1 {
+			group := commandAt(words[:1])
+			fmt.Fprintf(w, "complete -c 55h -n '__fish_seen_subcommand_from %s; and not __fish_seen_subcommand_from %s' -a %s -d %s\n",
+				words[0], strings.Join(commandNames(group), " "), words[1], fishQuote(cmd.Summary))
+			condition += "; and __fish_seen_subcommand_from " + words[1]
+		}
+		for _, f := range cmd.Flags {
+			line := fmt.Sprintf("complete -c 55h -n '%s' -l %s", condition, f.Name)
+			if f.Short != "" {
+				line += " -s " + f.Short
+			}
+			if f.Arg != "" {
+				line += " -r"
+			}
+			if len(f.Values) > 0 {
+				line += " -x -a " + fishQuote(strings.Join(f.Values, " "))
+			}
+			fmt.Fprintln(w, line+" -d "+fishQuote(f.Usage))
+		}
+		if cmd.CompleteAliases {
+			fmt.Fprintf(w, "complete -c 55h -n '%s' -a '(55h __complete aliases 2>/dev/null)'\n", condition)
+		}
+		if len(cmd.ArgValues) > 0 {
+			fmt.Fprintf(w, "complete -c 55h -n '%s' -a %s\n", condition, fishQuote(strings.Join(cmd.ArgValues, " ")))
+		}
+	}
+}
+
+// roff escapes text for the man page.
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeManPage renders the command tree, key bindings and files as a
+// section 1 man page.
+func writeManPage(w io.Writer, root *cliCommand) {
+	fmt.Fprintf(w, ".TH 55H 1 %q %q \"55h manual\"\n", time.Now().Format("2006-01-02"), "55h "+versionLabel())
+	fmt.Fprintf(w, ".SH NAME\n55h \\- %s\n", roff(root.Summary))
+	fmt.Fprint(w, ".SH SYNOPSIS\n.B 55h\n.br\n.B 55h\n.I query...\n[\\fB\\-\\-\\fR \\fIcommand...\\fR]\n.br\n.B 55h\n.I command\n[\\fIflags\\fR]\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\n%s\n", roff(root.Description))
+
+	fmt.Fprint(w, ".SH COMMANDS\n")
+	for _, words := range leafCommands(root, nil) {
+		cmd := commandAt(words)
+		if words[len(words)-1] != cmd.Name {
+			continue
+		}
+		fmt.Fprintf(w, ".SS %s\n", roff(strings.TrimPrefix(cmd.usageLine(), "55h ")))
+		description := cmd.Description
+		if description == "" {
+			description = cmd.Summary
+		}
+		fmt.Fprintf(w, "%s\n", roff(strings.SplitN(description, "\n\n", 2)[0]))
+		if len(cmd.Aliases) > 0 {
+			fmt.Fprintf(w, ".PP\nAliases: %s\n", roff(strings.Join(cmd.Aliases, ", ")))
+		}
+		for _, f := range cmd.Flags {
+			fmt.Fprintf(w, ".TP\n.B %s\n", roff(strings.TrimSpace(f.flagLabel())))
+			usage := f.Usage
+			if len(f.Values) > 0 {
+				usage += ": " + strings.Join(f.Values, ", ")
+			}
+			fmt.Fprintf(w, "%s\n", roff(usage))
+		}
+	}
+
+	fmt.Fprint(w, ".SH KEYS\nIn the host browser:\n")
+	keys := append(append([][2]string{}, helpNavigationKeys...), helpActionKeys...)
+	for _, key := range keys {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(key[0]), roff(key[1]))
+	}
+
+	fmt.Fprint(w, ".SH ENVIRONMENT\n")
+	env := [][2]string{
+		{"SSH_CONFIG", "Config file to open instead of ~/.ssh/config."},
+		{"VISUAL, EDITOR", "Editor used by E."},
+	}
+	for _, e := range env {
+		fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roff(e[0]), roff(e[1]))
+	}
+	fmt.Fprint(w, ".SH FILES\n")
+	files := map[string]string{
+		"~/.ssh/config":              "SSH client configuration, with every Include followed.",
+		"~/.config/55h/config.yml":   "Settings such as theme, connect_mode, group_by, sort and add_file.",
+		"~/.config/55h/access.json":  "Connection history per host: first and last access, count and session time.",
+		"~/.config/55h/backups/":     "Previous contents of config files 55h wrote, with the change that replaced them.",
+		"~/.config/55h/pins.json":    "Pinned host aliases.",
+		"~/.config/55h/undo.json":    "Undo and redo history of config changes, pointing into backups/.",
+		"~/.config/55h/checks.json":  "Last connection test per host.",
+		"~/.config/55h/latency.json": "Recent connection timings per host.",
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(w, ".TP\n.I %s\n%s\n", roff(path), roff(files[path]))
+	}
+	fmt.Fprint(w, ".SH SEE ALSO\n.BR ssh (1),\n.BR ssh_config (5)\n")
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// findHostEntry returns the single Host block that defines alias, or an
+// error naming every candidate when there is none or more than one.
+func findHostEntry(entries []HostEntry, alias string) (HostEntry, error) {
+	matches := hostDefinitions(entries, alias)
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		suggestions := []string{}
+		for _, alias2 := range checkTargets(entries) {
+			if fuzzyMatch(alias, alias2) {
+				suggestions = append(suggestions, alias2)
+			}
+		}
+		if len(suggestions) > 0 {
+			return HostEntry{}, fmt.Errorf("no host named %q (did you mean: %s?)", alias, strings.Join(suggestions, ", "))
+		}
+		return HostEntry{}, fmt.Errorf("no host named %q", alias)
+	}
+	places := make([]string, len(matches))
+	for i, m := range matches {
+		places[i] = fmt.Sprintf("%s:%d", m.SourcePath, m.StartLine)
+	}
+	return HostEntry{}, fmt.Errorf("alias %q is ambiguous, it is defined at %s", alias, strings.Join(places, ", "))
+}
+
+// hostDefinitions returns every Host block that lists alias.
+func hostDefinitions(entries []HostEntry, alias string) []HostEntry {
+	matches := []HostEntry{}
+	for _, entry := range entries {
+		if entry.IsMatch() {
+			continue
+		}
+		for _, p := range entry.Patterns {
+			if p == alias {
+				matches = append(matches, entry)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// selectHostEntry is findHostEntry for commands with --at, which picks one
+// of several definitions of an alias by the file and line of its Host line.
+// The file may be shortened to a trailing part of its path.
+func selectHostEntry(inv *cliInvocation, entries []HostEntry, alias string) (HostEntry, error) {
+	at := inv.Value("at")
+	if at == "" {
+		entry, err := findHostEntry(entries, alias)
+		if err != nil && len(hostDefinitions(entries, alias)) > 1 {
+			err = fmt.Errorf("%v; pick one with --at file:line", err)
+		}
+		return entry, err
+	}
+	i := strings.LastIndex(at, ":")
+	if i <= 0 {
+		return HostEntry{}, fmt.Errorf("--at needs file:line, got %q", at)
+	}
+	file := filepath.ToSlash(at[:i])
+	line, err := strconv.Atoi(at[i+1:])
+	if err != nil {
+		return HostEntry{}, fmt.Errorf("--at needs file:line, got %q", at)
+	}
+	matches := hostDefinitions(entries, alias)
+	if len(matches) == 0 {
+		return findHostEntry(entries, alias)
+	}
+	for _, entry := range matches {
+		path := filepath.ToSlash(entry.SourcePath)
+		if entry.StartLine == line && (path == file || strings.HasSuffix(path, "/"+file)) {
+			return entry, nil
+		}
+	}
+	return HostEntry{}, fmt.Errorf("alias %q is not defined at %s", alias, at)
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal it
+// refuses, so scripts have to pass --yes.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("stdin is not a terminal; pass --yes to confirm")
+	}
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// changeSet collects edited documents so a command can show one diff and
+// save them together.
+type changeSet struct {
+	// Reason describes the change in the backups Save makes.
+	Reason string
+	docs   []*ConfigDocument
+	before map[string][]byte
+}
+
+// open parses path once; later calls return the same document.
+func (c *changeSet) open(path string) (*ConfigDocument, error) {
+	for _, doc := range c.docs {
+		if doc.Path == path {
+			return doc, nil
+		}
+	}
+	doc, err := parseConfigDocument(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	if c.before == nil {
+		c.before = map[string][]byte{}
+	}
+	c.docs = append(c.docs, doc)
+	c.before[path] = doc.Bytes()
+	return doc, nil
+}
+
+func (c *changeSet) Diff() string {
+	var out strings.Builder
+	for _, doc := range c.docs {
+		out.WriteString(unifiedDiff(doc.Path, c.before[doc.Path], doc.Bytes()))
+	}
+	return out.String()
+}
+
+// Save writes the changed documents, in the order they were opened, as one
+// undoable operation.
+func (c *changeSet) Save() error {
+	changed := []*ConfigDocument{}
+	for _, doc := range c.docs {
+		if string(c.before[doc.Path]) != string(doc.Bytes()) {
+			changed = append(changed, doc)
+		}
+	}
+	if err := saveDocuments(c.Reason, changed...); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	return nil
+}
+
+// handleRemove implements: 55h rm <alias> [--block] [--yes] [--at file:line] [--dry-run]
+// When the Host line names other patterns too, only alias is dropped from
+// it unless --block asks for the whole block.
+func handleRemove(inv *cliInvocation) error {
+	args, yes, dryRun := inv.Args, inv.Has("yes"), inv.Has("dry-run")
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	entries, err := loadSSHConfig(inv.ConfigPath)
+	if err != nil {
+		return err
+	}
+	entry, err := selectHostEntry(inv, entries, args[0])
+	if err != nil {
+		return err
+	}
+
+	pattern, reason, question := "", "rm "+args[0], fmt.Sprintf("Delete host %s from %s?", args[0], entry.SourcePath)
+	if len(entry.Patterns) > 1 && !inv.Has("block") {
+		pattern, reason = args[0], "rm pattern "+args[0]
+		question = fmt.Sprintf("Remove %s from the Host line at %s:%d?", args[0], entry.SourcePath, entry.StartLine)
+	}
+	changes := &changeSet{Reason: reason}
+	doc, err := changes.open(entry.SourcePath)
+	if err != nil {
+		return err
+	}
+	if err := removeHostEntry(doc, entry, pattern); err != nil {
+		return err
+	}
+	fmt.Print(changes.Diff())
+	if dryRun {
+		return nil
+	}
+	if !yes {
+		ok, err := confirm(question)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("aborted")
+		}
+	}
+	return changes.Save()
+}
+
+// handleSet implements: 55h set <alias> [Key=Value ...] [-u Key ...] [--at file:line] [--dry-run]
+// It edits the host the same way the TUI form does.
+func handleSet(inv *cliInvocation) error {
+	args, dryRun := inv.Args, inv.Has("dry-run")
+	unsets := inv.Values("unset")
+	if len(args) == 0 || len(args) == 1 && len(unsets) == 0 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	alias := args[0]
+
+	type assignment struct {
+		key   string
+		value string
+	}
+	sets := []assignment{}
+	for _, a := range args[1:] {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("expected Key=Value, got %q", a)
+		}
+		sets = append(sets, assignment{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+
+	blocks, err := loadSSHConfigBlocks(inv.ConfigPath)
+	if err != nil {
+		return err
+	}
+	entries := withoutGlobalBlocks(blocks)
+	entry, err := selectHostEntry(inv, entries, alias)
+	if err != nil {
+		return err
+	}
+
+	form := formFromEntry(&entry)
+	policy := newKeywordPolicy(blocks, firstPattern(entry), form.Extras)
+	isTyped := func(key string) bool {
+		for _, k := range hostEditorKeys {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+	dropExtras := func(key string) {
+		kept := [][2]string{}
+		for _, opt := range form.Extras {
+			if !strings.EqualFold(opt[0], key) {
+				kept = append(kept, opt)
+			}
+		}
+		form.Extras = kept
+	}
+
+	for _, key := range unsets {
+		if isMetaKey(key) {
+			form.Meta.Set(key, "")
+			continue
+		}
+		canonical, err := checkHostKeyword(key, policy)
+		if err != nil {
+			return err
+		}
+		delete(form.Values, canonical)
+		dropExtras(canonical)
+	}
+	// setExtra gives a single-value key that isn't a form field one line,
+	// in place of its first occurrence.
+	setExtra := func(key, value string) {
+		kept, found := [][2]string{}, false
+		for _, opt := range form.Extras {
+			switch {
+			case !strings.EqualFold(opt[0], key):
+				kept = append(kept, opt)
+			case !found:
+				kept = append(kept, [2]string{key, value})
+				found = true
+			}
+		}
+		if !found {
+			kept = append(kept, [2]string{key, value})
+		}
+		form.Extras = kept
+	}
+
+	// Repeating a multi-value key (LocalForward=... LocalForward=...) sets
+	// all of its values. Any other key is written once with the last value
+	// given, since ssh would only use the first of several lines.
+	replaced := map[string]bool{}
+	for _, set := range sets {
+		if isMetaKey(set.key) {
+			form.Meta.Set(set.key, set.value)
+			continue
+		}
+		if set.value == "" {
+			canonical := canonicalKeyword(set.key)
+			return fmt.Errorf("%s needs a value; use -u %s to remove it", canonical, canonical)
+		}
+		canonical, err := checkHostOption(set.key, set.value, policy)
+		if err != nil {
+			return err
+		}
+		if !multiValueKeywords[strings.ToLower(canonical)] {
+			if isTyped(canonical) {
+				form.Values[canonical] = set.value
+			} else {
+				setExtra(canonical, set.value)
+			}
+			continue
+		}
+		if isTyped(canonical) && !replaced[canonical] {
+			form.Values[canonical] = set.value
+			dropExtras(canonical)
+			replaced[canonical] = true
+			continue
+		}
+		if !replaced[canonical] {
+			dropExtras(canonical)
+			replaced[canonical] = true
+		}
+		form.Extras = append(form.Extras, [2]string{canonical, set.value})
+	}
+
+	if err := validateHostForm(form, entries, &entry); err != nil {
+		return err
+	}
+	changes := &changeSet{Reason: "set " + alias}
+	doc, err := changes.open(entry.SourcePath)
+	if err != nil {
+		return err
+	}
+	if err := applyHostForm(doc, form, &entry); err != nil {
+		return err
+	}
+	fmt.Print(changes.Diff())
+	if dryRun {
+		return nil
+	}
+	if err := changes.Save(); err != nil {
+		return err
+	}
+	state := &AppState{}
+	state.loadAccessLog()
+	state.moveAccessRecord(accessKey(entry), form.accessKey())
+	return nil
+}
+
+// handleRename implements: 55h rename <old> <new> [--at file:line] [--dry-run]
+// ProxyJump hops naming the old alias are rewritten in every loaded file,
+// and the stored access, check and latency history moves to the new name.
+// When --at renames one of several definitions, the others keep the old
+// alias, so only the access record of the renamed block moves and ProxyJump
+// hops are left pointing at the old alias.
+func handleRename(inv *cliInvocation) error {
+	args, dryRun := inv.Args, inv.Has("dry-run")
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	oldAlias, newAlias := args[0], args[1]
+	if err := checkSingleAlias(newAlias); err != nil {
+		return err
+	}
+
+	blocks, err := loadSSHConfigBlocks(inv.ConfigPath)
+	if err != nil {
+		return err
+	}
+	entries := withoutGlobalBlocks(blocks)
+	entry, err := selectHostEntry(inv, entries, oldAlias)
+	if err != nil {
+		return err
+	}
+	if len(hostDefinitions(entries, newAlias)) > 0 {
+		return fmt.Errorf("alias %s already exists", newAlias)
+	}
+
+	changes := &changeSet{Reason: "rename " + oldAlias + " " + newAlias}
+	doc, err := changes.open(entry.SourcePath)
+	if err != nil {
+		return err
+	}
+	if err := doc.RenamePattern(entry.StartLine, oldAlias, newAlias); err != nil {
+		return err
+	}
+
+	files := []string{}
+	seenFile := map[string]bool{}
+	for _, block := range blocks {
+		if block.SourcePath != "" && !seenFile[block.SourcePath] {
+			seenFile[block.SourcePath] = true
+			files = append(files, block.SourcePath)
+		}
+	}
+	sort.Strings(files)
+	others := []string{}
+	for _, other := range hostDefinitions(entries, oldAlias) {
+		if other.SourcePath != entry.SourcePath || other.StartLine != entry.StartLine {
+			others = append(others, fmt.Sprintf("%s:%d", other.SourcePath, other.StartLine))
+		}
+	}
+	references := 0
+	if len(others) == 0 {
+		for _, path := range files {
+			doc, err := changes.open(path)
+			if err != nil {
+				return err
+			}
+			references += renameJumpReferences(doc, oldAlias, newAlias)
+		}
+	}
+
+	fmt.Print(changes.Diff())
+	if dryRun {
+		return nil
+	}
+	if err := changes.Save(); err != nil {
+		return err
+	}
+	renamed := entry
+	renamed.Patterns = append([]string{}, entry.Patterns...)
+	for i, p := range renamed.Patterns {
+		if p == oldAlias {
+			renamed.Patterns[i] = newAlias
+		}
+	}
+	state := &AppState{}
+	state.loadAccessLog()
+	state.moveAccessRecord(accessKey(entry), accessKey(renamed))
+	if len(others) > 0 {
+		fmt.Printf("renamed %s to %s; ProxyJump references were left alone, %s is still defined at %s\n", oldAlias, newAlias, oldAlias, strings.Join(others, ", "))
+		return nil
+	}
+	renameStoredHost(oldAlias, newAlias)
+	if references > 0 {
+		fmt.Printf("renamed %s to %s and updated %d ProxyJump reference(s)\n", oldAlias, newAlias, references)
+	} else {
+		fmt.Printf("renamed %s to %s\n", oldAlias, newAlias)
+	}
+	return nil
+}
+
+// checkSingleAlias refuses a name that a Host line would read as several
+// aliases or as a pattern.
+func checkSingleAlias(alias string) error {
+	if alias == "" || strings.ContainsAny(alias, " \t\"'*?!,") {
+		return fmt.Errorf("alias %q must be a single name without wildcards", alias)
+	}
+	return nil
+}
+
+// renameJumpReferences rewrites ProxyJump hops whose host is oldAlias,
+// keeping any user@ and :port, and returns how many lines changed.
+func renameJumpReferences(doc *ConfigDocument, oldAlias, newAlias string) int {
+	changed := 0
+	for _, line := range doc.Lines {
+		if !line.IsDirective() || !strings.EqualFold(line.Key, "ProxyJump") {
+			continue
+		}
+		hops := strings.Split(line.Value, ",")
+		touched := false
+		for i, hop := range hops {
+			_, host, _ := parseJumpSpec(strings.TrimSpace(hop))
+			if host != oldAlias {
+				continue
+			}
+			at := strings.LastIndex(hop, host)
+			hops[i] = hop[:at] + newAlias + hop[at+len(host):]
+			touched = true
+		}
+		if touched {
+			line.setValue(strings.Join(hops, ","))
+			changed++
+		}
+	}
+	return changed
+}
+
+// renameStoredHost moves the check and latency history and the pin, which
+// are kept per alias, to a new alias. The access record is keyed by the
+// whole block and moves with moveAccessRecord.
+func renameStoredHost(oldAlias, newAlias string) {
+	checks := loadCheckLog()
+	if result, ok := checks[oldAlias]; ok {
+		delete(checks, oldAlias)
+		checks[newAlias] = result
+		_ = saveCheckLog(checks)
+	}
+	history := loadLatencyLog()
+	if samples, ok := history[oldAlias]; ok {
+		delete(history, oldAlias)
+		history[newAlias] = samples
+		_ = saveLatencyLog(history)
+	}
+	pins := loadPins()
+	if pins[oldAlias] {
+		delete(pins, oldAlias)
+		pins[newAlias] = true
+		_ = savePins(pins)
+	}
+}
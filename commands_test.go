@@ -0,0 +1,308 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// runTestCommand writes files below a temporary directory ("config" is the
+// main config), runs the 55h command name with args against it and returns
+// the directory. The diff the command prints is discarded.
+func runTestCommand(t *testing.T, files map[string]string, name string, args ...string) (string, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for file, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := cliRoot.find(name)
+	if cmd == nil {
+		t.Fatalf("no command %s", name)
+	}
+	inv, _, err := parseCLIArgs(cmd, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv.ConfigPath = filepath.Join(dir, "config")
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+	return dir, cmd.Run(inv)
+}
+
+// readTestFile returns the content of name below dir.
+func readTestFile(t *testing.T, dir, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// commandTest runs one 55h command against config and compares the config
+// it leaves behind; an empty want means the command must fail.
+type commandTest struct {
+	name   string
+	config string
+	args   []string
+	want   string
+}
+
+func runCommandTests(t *testing.T, command string, tests []commandTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHome(t)
+			dir, err := runTestCommand(t, map[string]string{"config": tt.config}, command, tt.args...)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("%s %q succeeded, want an error", command, tt.args)
+				}
+				tt.want = tt.config
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTestFile(t, dir, "config"); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameJumpReferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		changed int
+	}{
+		{
+			name:    "single hop",
+			text:    "Host web\n    ProxyJump bastion\n",
+			want:    "Host web\n    ProxyJump gate\n",
+			changed: 1,
+		},
+		{
+			name:    "user and port are kept",
+			text:    "Host web\n    ProxyJump ops@bastion:2222\n",
+			want:    "Host web\n    ProxyJump ops@gate:2222\n",
+			changed: 1,
+		},
+		{
+			name:    "one hop of a chain",
+			text:    "Host web\n    ProxyJump edge,bastion,inner\n",
+			want:    "Host web\n    ProxyJump edge,gate,inner\n",
+			changed: 1,
+		},
+		{
+			name:    "user named like the host",
+			text:    "Host web\n    ProxyJump bastion@bastion\n",
+			want:    "Host web\n    ProxyJump bastion@gate\n",
+			changed: 1,
+		},
+		{
+			name:    "every block",
+			text:    "Host web\n    ProxyJump bastion\n\nHost db\n    ProxyJump bastion\n",
+			want:    "Host web\n    ProxyJump gate\n\nHost db\n    ProxyJump gate\n",
+			changed: 2,
+		},
+		{
+			name: "other hosts are left alone",
+			text: "Host web\n    ProxyJump bastion2,bastion.example.com\n    HostName bastion\n",
+			want: "Host web\n    ProxyJump bastion2,bastion.example.com\n    HostName bastion\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			changed := renameJumpReferences(doc, "bastion", "gate")
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed %d lines, want %d", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestHandleRename(t *testing.T) {
+	runCommandTests(t, "rename", []commandTest{
+		{
+			name:   "alias and ProxyJump hops",
+			config: "Host bastion\n    HostName b.example.com\n\nHost web\n    ProxyJump ops@bastion:2222,inner\n",
+			args:   []string{"bastion", "gate"},
+			want:   "Host gate\n    HostName b.example.com\n\nHost web\n    ProxyJump ops@gate:2222,inner\n",
+		},
+		{
+			name:   "one pattern of a Host line",
+			config: "Host bastion b\n    HostName b.example.com\n",
+			args:   []string{"bastion", "gate"},
+			want:   "Host gate b\n    HostName b.example.com\n",
+		},
+		{
+			name:   "--at leaves hops to the other definition",
+			config: "Host bastion\n    User a\n\nHost bastion\n    User b\n\nHost web\n    ProxyJump bastion\n",
+			args:   []string{"--at", "config:1", "bastion", "gate"},
+			want:   "Host gate\n    User a\n\nHost bastion\n    User b\n\nHost web\n    ProxyJump bastion\n",
+		},
+		{
+			name:   "--dry-run",
+			config: "Host bastion\n",
+			args:   []string{"--dry-run", "bastion", "gate"},
+			want:   "Host bastion\n",
+		},
+		{
+			name:   "new alias exists",
+			config: "Host bastion\n\nHost gate\n",
+			args:   []string{"bastion", "gate"},
+		},
+		{
+			name:   "new alias is a pattern",
+			config: "Host bastion\n",
+			args:   []string{"bastion", "gate*"},
+		},
+		{
+			name:   "unknown alias",
+			config: "Host bastion\n",
+			args:   []string{"nope", "gate"},
+		},
+	})
+}
+
+func TestHandleRenameAcrossIncludes(t *testing.T) {
+	useTestHome(t)
+	dir, err := runTestCommand(t, map[string]string{
+		"config": "Include work\n\nHost bastion\n    HostName b.example.com\n",
+		"work":   "Host db\n    ProxyJump bastion\n",
+	}, "rename", "bastion", "gate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := readTestFile(t, dir, "work"), "Host db\n    ProxyJump gate\n"; got != want {
+		t.Errorf("work = %q, want %q", got, want)
+	}
+}
+
+func TestHandleRenameMovesPin(t *testing.T) {
+	useTestHome(t)
+	if err := savePins(map[string]bool{"bastion": true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runTestCommand(t, map[string]string{"config": "Host bastion\n"}, "rename", "bastion", "gate"); err != nil {
+		t.Fatal(err)
+	}
+	if pins := loadPins(); !pins["gate"] || pins["bastion"] {
+		t.Errorf("pins = %v, want gate only", pins)
+	}
+}
+
+func TestHandleSet(t *testing.T) {
+	runCommandTests(t, "set", []commandTest{
+		{
+			name:   "change and add",
+			config: "Host web\n    HostName w\n    User root\n",
+			args:   []string{"web", "User=deploy", "Port=2222"},
+			want:   "Host web\n    HostName w\n    User deploy\n    Port 2222\n",
+		},
+		{
+			name:   "keyword case is canonical",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"web", "serveraliveinterval=30"},
+			want:   "Host web\n    HostName w\n    ServerAliveInterval 30\n",
+		},
+		{
+			name:   "unset",
+			config: "Host web\n    HostName w\n    User root\n    ForwardAgent yes\n",
+			args:   []string{"web", "-u", "User", "-u", "ForwardAgent"},
+			want:   "Host web\n    HostName w\n",
+		},
+		{
+			name:   "repeated multi-value key",
+			config: "Host web\n    HostName w\n    LocalForward 1 localhost:1\n",
+			args:   []string{"web", "LocalForward=8080 localhost:80", "LocalForward=8443 localhost:443"},
+			want:   "Host web\n    HostName w\n    LocalForward 8080 localhost:80\n    LocalForward 8443 localhost:443\n",
+		},
+		{
+			name:   "keyword allowed by IgnoreUnknown",
+			config: "Host *\n    IgnoreUnknown UseKeychain\n\nHost web\n    HostName w\n",
+			args:   []string{"web", "UseKeychain=yes"},
+			want:   "Host *\n    IgnoreUnknown UseKeychain\n\nHost web\n    HostName w\n    UseKeychain yes\n",
+		},
+		{
+			name:   "--dry-run",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"--dry-run", "web", "Port=2222"},
+			want:   "Host web\n    HostName w\n",
+		},
+		{
+			name:   "unknown keyword",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"web", "UseKeychain=yes"},
+		},
+		{
+			name:   "empty value",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"web", "Port="},
+		},
+		{
+			name:   "not an assignment",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"web", "Port"},
+		},
+		{
+			name:   "Host keyword",
+			config: "Host web\n    HostName w\n",
+			args:   []string{"web", "Host=evil"},
+		},
+	})
+}
+
+func TestHandleRemove(t *testing.T) {
+	runCommandTests(t, "rm", []commandTest{
+		{
+			name:   "whole block with its comments",
+			config: "Host a\n\n# the web host\nHost web\n    HostName w\n\nHost b\n",
+			args:   []string{"--yes", "web"},
+			want:   "Host a\n\nHost b\n",
+		},
+		{
+			name:   "one pattern of a Host line",
+			config: "Host web www\n    HostName w\n",
+			args:   []string{"--yes", "web"},
+			want:   "Host www\n    HostName w\n",
+		},
+		{
+			name:   "--block removes every pattern",
+			config: "Host a\n\nHost web www\n    HostName w\n",
+			args:   []string{"--yes", "--block", "web"},
+			want:   "Host a\n",
+		},
+		{
+			name:   "--at picks a definition",
+			config: "Host web\n    User a\n\nHost web\n    User b\n",
+			args:   []string{"--yes", "--at", "config:4", "web"},
+			want:   "Host web\n    User a\n",
+		},
+		{
+			name:   "--dry-run",
+			config: "Host web\n",
+			args:   []string{"--dry-run", "web"},
+			want:   "Host web\n",
+		},
+		{
+			name:   "unknown alias",
+			config: "Host web\n",
+			args:   []string{"--yes", "nope"},
+		},
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// connectCandidates returns the concrete hosts query selects, in list
+// order. An alias typed out in full wins over hosts that only match
+// fuzzily, so "55h web" still connects when "web-2" exists.
+func connectCandidates(entries []HostEntry, query string) ([]HostEntry, error) {
+	parsed, err := parseHostQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("bad query: %v", err)
+	}
+	matches := []HostEntry{}
+	for _, entry := range entries {
+		if entry.IsMatch() || len(entry.Patterns) == 0 || strings.ContainsAny(entry.Patterns[0], "*?!") {
+			continue
+		}
+		if !parsed.Match(entry) {
+			continue
+		}
+		for _, p := range entry.Patterns {
+			if p == query {
+				return []HostEntry{entry}, nil
+			}
+		}
+		matches = append(matches, entry)
+	}
+	return matches, nil
+}
+
+// handleConnect implements: 55h connect <query...> [-- command...]
+// One match connects right away; several open the host browser filtered
+// by the query.
+func handleConnect(inv *cliInvocation) error {
+	if len(inv.Args) == 0 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	query := strings.Join(inv.Args, " ")
+	entries, err := loadSSHConfig(inv.ConfigPath)
+	if err != nil {
+		return err
+	}
+
+	matches, err := connectCandidates(entries, query)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(matches) == 0:
+		return fmt.Errorf("no host matches %q", query)
+	case len(matches) > 1 && len(inv.Passthrough) > 0:
+		aliases := make([]string, len(matches))
+		for i, m := range matches {
+			aliases[i] = m.Patterns[0]
+		}
+		return fmt.Errorf("%q matches %d hosts (%s); narrow it down to run a command", query, len(matches), strings.Join(aliases, ", "))
+	case len(matches) > 1:
+		return runTUI(inv.ConfigPath, query)
+	}
+
+	entry := matches[0]
+	state := &AppState{ConfigPath: inv.ConfigPath}
+	state.loadAccessLog()
+	state.recordAccess(entry)
+	return execSSH(entry.Patterns[0], inv.Passthrough)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk.
+const diffContext = 3
+
+// maxDiffCells bounds the LCS table; larger changes are shown as one
+// replacement hunk.
+const maxDiffCells = 4_000_000
+
+// unifiedDiff renders the change from before to after as a unified diff of
+// path, or "" when nothing changed.
+func unifiedDiff(path string, before, after []byte) string {
+	if string(before) == string(after) {
+		return ""
+	}
+	a := splitDiffLines(string(before))
+	b := splitDiffLines(string(after))
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", path, path)
+	for start := 0; start < len(ops); {
+		// Find the next change and grow the hunk while changes are close.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		from := max(first-diffContext, start)
+		to := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				to = i
+			} else if i-to > 2*diffContext {
+				break
+			}
+		}
+		to = min(to+diffContext, len(ops)-1)
+
+		aStart, bStart, aLen, bLen := ops[from].aLine, ops[from].bLine, 0, 0
+		for _, op := range ops[from : to+1] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[from : to+1] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = to + 1
+	}
+	return out.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func splitDiffLines(text string) []string {
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffOp is one line of a diff: ' ' kept, '-' removed, '+' added. aLine and
+// bLine are the 1-based positions the line has, or would have, in each side.
+type diffOp struct {
+	kind         byte
+	text         string
+	aLine, bLine int
+}
+
+// diffLines aligns a and b on their longest common subsequence, after
+// trimming the common prefix and suffix.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	ops := []diffOp{}
+	ai, bi := 0, 0
+	keep := func(text string) {
+		ops = append(ops, diffOp{' ', text, ai + 1, bi + 1})
+		ai++
+		bi++
+	}
+	remove := func(text string) {
+		ops = append(ops, diffOp{'-', text, ai + 1, bi + 1})
+		ai++
+	}
+	add := func(text string) {
+		ops = append(ops, diffOp{'+', text, ai + 1, bi + 1})
+		bi++
+	}
+
+	for _, line := range a[:prefix] {
+		keep(line)
+	}
+	if (len(midA)+1)*(len(midB)+1) > maxDiffCells {
+		for _, line := range midA {
+			remove(line)
+		}
+		for _, line := range midB {
+			add(line)
+		}
+	} else {
+		// lcs[i][j] is the LCS length of midA[i:] and midB[j:].
+		lcs := make([][]int, len(midA)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(midB)+1)
+		}
+		for i := len(midA) - 1; i >= 0; i-- {
+			for j := len(midB) - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(midA) || j < len(midB) {
+			switch {
+			case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+				keep(midA[i])
+				i++
+				j++
+			case j < len(midB) && (i == len(midA) || lcs[i][j+1] > lcs[i+1][j]):
+				add(midB[j])
+				j++
+			default:
+				remove(midA[i])
+				i++
+			}
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		keep(line)
+	}
+	return ops
+}
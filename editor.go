@@ -0,0 +1,710 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// hostEditorKeys are the options with a dedicated field in the host editor,
+// in display order. Everything else goes to the free-form options area.
+var hostEditorKeys = []string{
+	"HostName",
+	"User",
+	"Port",
+	"IdentityFile",
+	"ProxyJump",
+	"ForwardAgent",
+	"IdentitiesOnly",
+	"ServerAliveInterval",
+	"ServerAliveCountMax",
+}
+
+var hostEditorBoolKeys = map[string]bool{
+	"ForwardAgent":   true,
+	"IdentitiesOnly": true,
+}
+
+// hostForm is what the editor collects before anything is written.
+type hostForm struct {
+	Patterns []string
+	Values   map[string]string
+	Extras   [][2]string
+	Meta     HostMeta
+}
+
+// accessKey is the access log key of the host as the form would save it.
+func (form hostForm) accessKey() string {
+	return accessKey(HostEntry{
+		Patterns: form.Patterns,
+		HostName: form.Values["HostName"],
+		User:     form.Values["User"],
+		Port:     form.Values["Port"],
+	})
+}
+
+// formFromEntry prefills the editor. A nil entry yields an empty form.
+func formFromEntry(entry *HostEntry) hostForm {
+	form := hostForm{Values: map[string]string{}}
+	if entry == nil {
+		return form
+	}
+	form.Patterns = append([]string{}, entry.Patterns...)
+	form.Meta = entry.Meta
+	for _, key := range hostEditorKeys {
+		if value, ok := entry.Option(key); ok {
+			if hostEditorBoolKeys[key] {
+				if b, ok := parseBoolVal(value); ok {
+					value = formatBoolYesNo(*b)
+				}
+			}
+			form.Values[key] = value
+		}
+	}
+	for _, opt := range entry.ExtraOptions() {
+		form.Extras = append(form.Extras, [2]string{opt.Key, opt.Value})
+	}
+	return form
+}
+
+// cloneForm prefills the form for a copy of source: every directive and its
+// metadata, under a suggested alias.
+func cloneForm(source HostEntry, entries []HostEntry) hostForm {
+	form := formFromEntry(&source)
+	form.Patterns = []string{cloneAlias(firstPattern(source), entries)}
+	return form
+}
+
+// cloneAlias suggests a free alias for a copy of alias: a trailing number is
+// counted up (web-09 → web-10), anything else gets "-2", "-3" and so on.
+func cloneAlias(alias string, entries []HostEntry) string {
+	taken := map[string]bool{}
+	for _, e := range entries {
+		if e.IsMatch() {
+			continue
+		}
+		for _, p := range e.Patterns {
+			taken[p] = true
+		}
+	}
+	stem := strings.TrimRight(alias, "0123456789")
+	n, width := 1, 0
+	if digits := alias[len(stem):]; digits != "" {
+		n, _ = strconv.Atoi(digits)
+		width = len(digits)
+	} else {
+		stem += "-"
+	}
+	for {
+		n++
+		if candidate := fmt.Sprintf("%s%0*d", stem, width, n); !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// formatExtras renders extra options one "Key Value" per line.
+func formatExtras(extras [][2]string) string {
+	lines := make([]string, 0, len(extras))
+	for _, opt := range extras {
+		lines = append(lines, opt[0]+" "+opt[1])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseExtras reads the free-form options area. Blank lines and comments are
+// ignored; both "Key Value" and "Key=Value" are accepted.
+func parseExtras(text string, policy keywordPolicy) ([][2]string, error) {
+	extras := [][2]string{}
+	for i, raw := range strings.Split(text, "\n") {
+		line := parseConfigLine(strings.TrimSpace(raw))
+		if !line.IsDirective() {
+			continue
+		}
+		key, err := checkHostOption(line.Key, line.Value, policy)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		extras = append(extras, [2]string{key, line.Value})
+	}
+	return extras, nil
+}
+
+// checkHostKeyword accepts a keyword for inside a Host block and returns it
+// in canonical case. Other unknown keywords are refused, since ssh rejects
+// the whole file over one of them.
+func checkHostKeyword(key string, policy keywordPolicy) (string, error) {
+	canonical := canonicalKeyword(key)
+	if !policy.accepts(canonical) {
+		return "", fmt.Errorf("unknown option %q", key)
+	}
+	switch strings.ToLower(canonical) {
+	case "host", "match", "include":
+		return "", fmt.Errorf("%s is not allowed inside a host", canonical)
+	}
+	return canonical, nil
+}
+
+// checkHostOption is checkHostKeyword for a directive with its value.
+func checkHostOption(key, value string, policy keywordPolicy) (string, error) {
+	canonical, err := checkHostKeyword(key, policy)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s needs a value", canonical)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("%s must fit on one line", canonical)
+	}
+	return canonical, nil
+}
+
+// parseHostPatterns splits the Host field. Quotes are refused before
+// splitting: splitArgs would drop them, and a quoted alias with a space in it
+// would then be written back as two.
+func parseHostPatterns(text string) ([]string, error) {
+	if strings.ContainsAny(text, "\"'") {
+		return nil, fmt.Errorf("aliases must not contain quotes")
+	}
+	return strings.Fields(text), nil
+}
+
+// validateHostForm checks the form against the loaded entries. original is
+// the entry being edited, or nil when adding.
+func validateHostForm(form hostForm, entries []HostEntry, original *HostEntry) error {
+	if len(form.Patterns) == 0 {
+		return fmt.Errorf("Host needs at least one alias")
+	}
+	// Patterns from the command line (--name) are not split, so they can
+	// still hold what a Host line can't express unquoted.
+	for _, p := range form.Patterns {
+		if strings.ContainsAny(p, "\"' \t") {
+			return fmt.Errorf("alias %q must not contain quotes or spaces", p)
+		}
+	}
+	// An edit only has to keep the aliases it adds unique; a host that
+	// already shares an alias with another block can still be edited.
+	kept := map[string]bool{}
+	if original != nil {
+		for _, p := range original.Patterns {
+			kept[p] = true
+		}
+	}
+	for _, e := range entries {
+		if e.IsMatch() {
+			continue
+		}
+		if original != nil && e.SourcePath == original.SourcePath && e.StartLine == original.StartLine {
+			continue
+		}
+		for _, p := range e.Patterns {
+			for _, alias := range form.Patterns {
+				// Wildcard and negated patterns are rules that several
+				// blocks may share; only concrete aliases must be unique.
+				if p == alias && !kept[alias] && !strings.ContainsAny(alias, "*?!") {
+					return fmt.Errorf("alias %s already exists in %s", p, e.SourcePath)
+				}
+			}
+		}
+	}
+	if err := validateMeta(form.Meta); err != nil {
+		return err
+	}
+	if strings.ContainsAny(form.Values["HostName"], " \t") {
+		return fmt.Errorf("HostName must not contain spaces")
+	}
+	if port := form.Values["Port"]; port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("Port must be a number between 1 and 65535")
+		}
+	}
+	for _, key := range []string{"ServerAliveInterval", "ServerAliveCountMax"} {
+		if v := form.Values[key]; v != "" {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return fmt.Errorf("%s must be a non-negative number", key)
+			}
+		}
+	}
+	if jump := form.Values["ProxyJump"]; jump != "" && !strings.EqualFold(jump, "none") {
+		for _, hop := range strings.Split(jump, ",") {
+			if strings.TrimSpace(hop) == "" || strings.ContainsAny(hop, " \t") {
+				return fmt.Errorf("ProxyJump must be a comma-separated list of hosts")
+			}
+		}
+	}
+	return nil
+}
+
+// newHostLines renders the form as a new block: the metadata comment, the
+// typed fields in editor order, then the other options.
+func newHostLines(doc *ConfigDocument, form hostForm) []*ConfigLine {
+	options := [][2]string{}
+	for _, key := range hostEditorKeys {
+		if v := form.Values[key]; v != "" {
+			options = append(options, [2]string{key, v})
+		}
+	}
+	options = append(options, form.Extras...)
+	lines := doc.blockLines(form.Patterns, options)
+	if !form.Meta.IsEmpty() {
+		lines = append([]*ConfigLine{doc.newLine(form.Meta.Comment())}, lines...)
+	}
+	return lines
+}
+
+// insertClone writes the form as a new block right after the block of
+// source, which must still be where it was loaded from.
+func insertClone(doc *ConfigDocument, form hostForm, source HostEntry) error {
+	if _, err := findEntryBlock(doc, source); err != nil {
+		return err
+	}
+	_, err := doc.InsertBlockAfter(source.StartLine, newHostLines(doc, form))
+	return err
+}
+
+// applyHostForm writes the form into doc. For a new host the block is
+// appended; for an existing one only lines whose value changed are touched.
+func applyHostForm(doc *ConfigDocument, form hostForm, original *HostEntry) error {
+	if original == nil {
+		doc.appendBlock(newHostLines(doc, form))
+		return nil
+	}
+
+	block, err := doc.FindBlock(original.StartLine)
+	if err != nil || block.Kind != BlockHost || strings.Join(block.Patterns, " ") != strings.Join(original.Patterns, " ") {
+		return fmt.Errorf("%s changed on disk; reload and try again", original.SourcePath)
+	}
+
+	// In-place changes first, then removals bottom-up, then appends and a new
+	// metadata comment, so the line indexes taken from the parsed entry stay
+	// valid throughout.
+	if strings.Join(form.Patterns, " ") != strings.Join(original.Patterns, " ") {
+		doc.Lines[block.Header].setValue(strings.Join(form.Patterns, " "))
+	}
+	remove := []int{}
+	appendOpts := [][2]string{}
+	for _, key := range hostEditorKeys {
+		newValue := form.Values[key]
+		idx := -1
+		oldValue := ""
+		for _, opt := range original.Options {
+			if strings.EqualFold(opt.Key, key) {
+				idx, oldValue = opt.Line-1, opt.Value
+				break
+			}
+		}
+		switch {
+		case idx >= 0 && newValue == "":
+			remove = append(remove, idx)
+		case idx >= 0 && !sameOptionValue(key, oldValue, newValue):
+			doc.Lines[idx].setValue(newValue)
+		case idx < 0 && newValue != "":
+			appendOpts = append(appendOpts, [2]string{key, newValue})
+		}
+	}
+	oldExtras := formFromEntry(original).Extras
+	if formatExtras(oldExtras) != formatExtras(form.Extras) {
+		for _, opt := range original.ExtraOptions() {
+			remove = append(remove, opt.Line-1)
+		}
+		appendOpts = append(appendOpts, form.Extras...)
+	}
+
+	metaRemove, metaAbove := doc.editMetaComment(original.Meta, form.Meta)
+	remove = append(remove, metaRemove...)
+
+	sort.Sort(sort.Reverse(sort.IntSlice(remove)))
+	header := block.Header
+	for _, idx := range remove {
+		doc.removeLines(idx, idx)
+		if idx < header {
+			header--
+		}
+	}
+	if len(appendOpts) > 0 {
+		if err := doc.AppendOptions(header+1, appendOpts); err != nil {
+			return err
+		}
+	}
+	if metaAbove {
+		doc.insertLines(header, doc.newLine(form.Meta.Comment()))
+	}
+	return nil
+}
+
+func sameOptionValue(key, oldValue, newValue string) bool {
+	if hostEditorBoolKeys[key] {
+		a, okA := parseBoolVal(oldValue)
+		b, okB := parseBoolVal(newValue)
+		if okA && okB {
+			return *a == *b
+		}
+	}
+	return oldValue == newValue
+}
+
+// identityFileCandidates lists private keys in ~/.ssh for the key picker.
+func identityFileCandidates() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	dirEntries, err := os.ReadDir(filepath.Join(home, ".ssh"))
+	if err != nil {
+		return nil
+	}
+	skip := map[string]bool{"config": true, "known_hosts": true, "known_hosts.old": true, "authorized_keys": true, "environment": true}
+	candidates := []string{}
+	for _, d := range dirEntries {
+		name := d.Name()
+		if d.IsDir() || skip[name] || strings.HasSuffix(name, ".pub") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		candidates = append(candidates, "~/.ssh/"+name)
+	}
+	return candidates
+}
+
+// aliasCompletions suggests host aliases for the last hop of a ProxyJump list.
+func (state *AppState) aliasCompletions(text string) []string {
+	prefix := ""
+	last := text
+	if i := strings.LastIndex(text, ","); i >= 0 {
+		prefix, last = text[:i+1], text[i+1:]
+	}
+	if last == "" {
+		return nil
+	}
+	matches := []string{}
+	for _, e := range state.Entries {
+		if e.IsMatch() {
+			continue
+		}
+		for _, p := range e.Patterns {
+			if strings.ContainsAny(p, "*?!") {
+				continue
+			}
+			if strings.HasPrefix(strings.ToLower(p), strings.ToLower(last)) && p != last {
+				matches = append(matches, prefix+p)
+			}
+		}
+	}
+	return matches
+}
+
+// showHostEditor opens the add/edit form. Pass nil to add a new host. A
+// non-nil source instead adds a copy of it, prefilled for review and written
+// right after it in its file.
+func (state *AppState) showHostEditor(original, source *HostEntry) {
+	if original != nil && original.IsMatch() {
+		state.showMessageModal("Match Rule", "Match blocks cannot be edited in the form.")
+		return
+	}
+	if source != nil && source.IsMatch() {
+		state.showMessageModal("Match Rule", "Match blocks cannot be cloned in the form.")
+		return
+	}
+
+	state.ThemeModalOpen = true
+	state.App.EnableMouse(false)
+
+	theme := state.currentTheme()
+	initial := formFromEntry(original)
+
+	title := " Add Host "
+	targetPath := state.addTargetPath()
+	if original != nil {
+		title = fmt.Sprintf(" Edit Host: %s ", strings.Join(original.Patterns, " "))
+		targetPath = original.SourcePath
+	} else if source != nil {
+		initial = cloneForm(*source, state.Entries)
+		title = fmt.Sprintf(" Clone Host: %s ", strings.Join(source.Patterns, " "))
+		targetPath = source.SourcePath
+	}
+
+	modalBox := tview.NewFlex().SetDirection(tview.FlexRow)
+	modalBox.SetBorder(true)
+	modalBox.SetTitle(title)
+	modalBox.SetTitleAlign(tview.AlignCenter)
+	modalBox.SetBackgroundColor(theme.PanelBg)
+	modalBox.SetBorderColor(theme.Border)
+	modalBox.SetTitleColor(theme.Text)
+
+	form := tview.NewForm()
+	form.SetItemPadding(0)
+	form.SetBackgroundColor(theme.PanelBg)
+	form.SetLabelColor(theme.Label)
+	form.SetFieldBackgroundColor(theme.Bg)
+	form.SetFieldTextColor(theme.Text)
+	form.SetButtonBackgroundColor(theme.Accent)
+	form.SetButtonTextColor(theme.Bg)
+	form.SetButtonsAlign(tview.AlignCenter)
+
+	inputs := map[string]*tview.InputField{}
+	toggles := map[string]*tview.DropDown{}
+	toggleOptions := []string{"(unset)", "yes", "no"}
+
+	hostInput := tview.NewInputField().SetLabel("Host").SetText(strings.Join(initial.Patterns, " "))
+	hostInput.SetPlaceholder("alias [more patterns...]")
+	form.AddFormItem(hostInput)
+	for _, key := range hostEditorKeys {
+		if hostEditorBoolKeys[key] {
+			current := 0
+			for i, opt := range toggleOptions {
+				if opt == initial.Values[key] {
+					current = i
+				}
+			}
+			dd := tview.NewDropDown().SetLabel(key).SetOptions(toggleOptions, nil).SetCurrentOption(current)
+			dd.SetListStyles(
+				tcell.StyleDefault.Foreground(theme.Text).Background(theme.Bg),
+				tcell.StyleDefault.Foreground(theme.Bg).Background(theme.Accent),
+			)
+			toggles[key] = dd
+			form.AddFormItem(dd)
+			continue
+		}
+		input := tview.NewInputField().SetLabel(key).SetText(initial.Values[key])
+		input.SetPlaceholderStyle(tcell.StyleDefault.Foreground(theme.Muted).Background(theme.Bg))
+		inputs[key] = input
+		form.AddFormItem(input)
+	}
+	inputs["ProxyJump"].SetAutocompleteFunc(state.aliasCompletions)
+	inputs["ProxyJump"].SetAutocompleteStyles(theme.PanelBg,
+		tcell.StyleDefault.Foreground(theme.Text).Background(theme.PanelBg),
+		tcell.StyleDefault.Foreground(theme.Bg).Background(theme.Accent))
+	inputs["IdentityFile"].SetPlaceholder("~/.ssh/id_ed25519 (Keys… to browse)")
+
+	tagsInput := tview.NewInputField().SetLabel("Tags").SetText(strings.Join(initial.Meta.Tags, ","))
+	tagsInput.SetPlaceholder("prod,db")
+	ownerInput := tview.NewInputField().SetLabel("Owner").SetText(initial.Meta.Owner)
+	noteInput := tview.NewInputField().SetLabel("Note").SetText(initial.Meta.Note)
+	for _, input := range []*tview.InputField{tagsInput, ownerInput, noteInput} {
+		input.SetPlaceholderStyle(tcell.StyleDefault.Foreground(theme.Muted).Background(theme.Bg))
+		form.AddFormItem(input)
+	}
+
+	extrasArea := tview.NewTextArea().SetLabel("Options")
+	extrasArea.SetText(formatExtras(initial.Extras), false)
+	extrasArea.SetPlaceholder("One per line, e.g. LocalForward 8080 localhost:80")
+	extrasArea.SetSize(5, 0)
+	extrasArea.SetTextStyle(tcell.StyleDefault.Foreground(theme.Text).Background(theme.Bg))
+	extrasArea.SetPlaceholderStyle(tcell.StyleDefault.Foreground(theme.Muted).Background(theme.Bg))
+	form.AddFormItem(extrasArea)
+
+	errorText := tview.NewTextView()
+	errorText.SetDynamicColors(true)
+	errorText.SetTextAlign(tview.AlignCenter)
+	errorText.SetBackgroundColor(theme.PanelBg)
+
+	footerText := tview.NewTextView()
+	footerText.SetTextAlign(tview.AlignCenter)
+	footerText.SetTextColor(theme.Muted)
+	footerText.SetBackgroundColor(theme.PanelBg)
+	footerText.SetText(fmt.Sprintf("Tab next  Ctrl-S save  Esc cancel  → %s", shortenPath(targetPath, 30)))
+
+	closeModal := func() {
+		state.App.EnableMouse(true)
+		state.Pages.RemovePage("editor-modal")
+		state.ThemeModalOpen = false
+		state.App.SetFocus(state.HostList)
+	}
+
+	collect := func() (hostForm, error) {
+		values := hostForm{Values: map[string]string{}}
+		patterns, err := parseHostPatterns(hostInput.GetText())
+		if err != nil {
+			return values, err
+		}
+		values.Patterns = patterns
+		for key, input := range inputs {
+			values.Values[key] = strings.TrimSpace(input.GetText())
+		}
+		for key, dd := range toggles {
+			if i, _ := dd.GetCurrentOption(); i > 0 {
+				values.Values[key] = toggleOptions[i]
+			}
+		}
+		// Keys other than tags, owner and note are kept as they were
+		values.Meta = HostMeta{Other: initial.Meta.Other}
+		values.Meta.Set("tags", tagsInput.GetText())
+		values.Meta.Set("owner", strings.TrimSpace(ownerInput.GetText()))
+		values.Meta.Set("note", strings.TrimSpace(noteInput.GetText()))
+		// Options the block already had are kept even if this ssh_config
+		// keyword list doesn't know them
+		alias := ""
+		if len(patterns) > 0 {
+			alias = patterns[0]
+		}
+		policy := newKeywordPolicy(state.Blocks, alias, initial.Extras)
+		extras, err := parseExtras(extrasArea.GetText(), policy)
+		if err != nil {
+			return values, err
+		}
+		values.Extras = extras
+		return values, validateHostForm(values, state.Entries, original)
+	}
+
+	save := func() {
+		values, err := collect()
+		if err == nil {
+			err = state.writeHostForm(targetPath, values, original, source)
+		}
+		if err != nil {
+			errorText.SetText(fmt.Sprintf("[%s]%s[-]", theme.MarkupError, tview.Escape(err.Error())))
+			return
+		}
+		closeModal()
+		state.reload()
+		state.selectEntry(targetPath, values.Patterns[0])
+	}
+
+	showKeyPicker := func() {
+		candidates := identityFileCandidates()
+		if len(candidates) == 0 {
+			errorText.SetText(fmt.Sprintf("[%s]No private keys found in ~/.ssh[-]", theme.MarkupWarning))
+			return
+		}
+		picker := tview.NewList()
+		picker.ShowSecondaryText(false)
+		picker.SetHighlightFullLine(true)
+		picker.SetBorder(true)
+		picker.SetTitle(" Identity Files ")
+		picker.SetBackgroundColor(theme.PanelBg)
+		picker.SetBorderColor(theme.Border)
+		picker.SetTitleColor(theme.Text)
+		picker.SetMainTextStyle(tcell.StyleDefault.Foreground(theme.Text).Background(theme.PanelBg))
+		picker.SetSelectedBackgroundColor(theme.Accent)
+		picker.SetSelectedTextColor(theme.Bg)
+		for _, c := range candidates {
+			picker.AddItem(c, "", 0, nil)
+		}
+		closePicker := func() {
+			state.Pages.RemovePage("key-picker")
+			state.App.SetFocus(inputs["IdentityFile"])
+		}
+		picker.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+			inputs["IdentityFile"].SetText(mainText)
+			closePicker()
+		})
+		picker.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyEsc {
+				closePicker()
+				return nil
+			}
+			return event
+		})
+		pickerHeight := len(candidates) + 2
+		if pickerHeight > 14 {
+			pickerHeight = 14
+		}
+		pickerFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+				AddItem(nil, 0, 1, false).
+				AddItem(picker, 50, 0, true).
+				AddItem(nil, 0, 1, false), pickerHeight, 0, true).
+			AddItem(nil, 0, 1, false)
+		state.Pages.AddPage("key-picker", pickerFlex, true, true)
+		state.App.SetFocus(picker)
+	}
+
+	form.AddButton("Save", save)
+	form.AddButton("Keys…", showKeyPicker)
+	form.AddButton("Cancel", closeModal)
+	form.SetCancelFunc(closeModal)
+
+	modalBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyCtrlS {
+			save()
+			return nil
+		}
+		return event
+	})
+
+	modalBox.AddItem(form, 0, 1, true)
+	modalBox.AddItem(errorText, 1, 0, false)
+	modalBox.AddItem(footerText, 1, 0, false)
+
+	modalWidth := 76
+	// Form padding (2) + 13 single-row fields + 5-row options area + gap and
+	// button row (2), plus the error line, footer and border.
+	modalHeight := 2 + 13 + 5 + 2 + 2 + 2
+
+	modalFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(modalBox, modalWidth, 0, true).
+			AddItem(nil, 0, 1, false), modalHeight, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	state.Pages.AddPage("editor-modal", modalFlex, true, true)
+	state.App.SetFocus(form)
+}
+
+// writeHostForm applies the form to the file at path and saves it. source is
+// the entry a new host was cloned from, if any.
+func (state *AppState) writeHostForm(path string, form hostForm, original, source *HostEntry) error {
+	if path == "" {
+		return fmt.Errorf("unable to resolve config path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create parent dir: %v", err)
+	}
+	doc, err := parseConfigDocument(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	reason := "add "
+	if original != nil {
+		reason = "edit "
+	} else if source != nil {
+		reason = "clone " + firstPattern(*source) + " "
+	}
+	if len(form.Patterns) > 0 {
+		reason += form.Patterns[0]
+	}
+	if source != nil && original == nil {
+		err = insertClone(doc, form, *source)
+	} else {
+		err = applyHostForm(doc, form, original)
+	}
+	if err != nil {
+		return err
+	}
+	if err := doc.Save(reason); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	if original != nil {
+		state.moveAccessRecord(accessKey(*original), form.accessKey())
+		state.renameStoredAlias(*original, form)
+	}
+	return nil
+}
+
+// renameStoredAlias moves the pin and the check and latency history when an
+// edit changed the first alias, as 55h rename does. They stay put while the
+// old alias is still listed in the form or defined by another block.
+func (state *AppState) renameStoredAlias(original HostEntry, form hostForm) {
+	oldAlias, newAlias := firstPattern(original), form.Patterns[0]
+	if oldAlias == "" || oldAlias == newAlias || len(hostDefinitions(state.Entries, oldAlias)) > 1 {
+		return
+	}
+	for _, p := range form.Patterns {
+		if p == oldAlias {
+			return
+		}
+	}
+	renameStoredHost(oldAlias, newAlias)
+	state.Pins = loadPins()
+	state.loadChecks()
+	state.loadLatency()
+}
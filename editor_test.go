@@ -0,0 +1,214 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestEntries writes text as a config file and loads it like the TUI.
+func loadTestEntries(t *testing.T, text string) (string, []HostEntry) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := loadSSHConfigBlocks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, blocks
+}
+
+func TestParseExtrasKeywords(t *testing.T) {
+	const config = "Host *.mac\n    IgnoreUnknown UseKeychain,Apple*\n\nHost web\n    NewerKeyword on\n"
+	_, blocks := loadTestEntries(t, config)
+	existing := [][2]string{{"NewerKeyword", "on"}}
+	tests := []struct {
+		name  string
+		alias string
+		text  string
+		ok    bool
+	}{
+		{name: "known keyword", alias: "web", text: "LocalForward 8080 localhost:80", ok: true},
+		{name: "keyword the block already has", alias: "web", text: "NewerKeyword off", ok: true},
+		{name: "new unknown keyword", alias: "web", text: "UseKeychain yes"},
+		{name: "covered by IgnoreUnknown", alias: "laptop.mac", text: "UseKeychain yes", ok: true},
+		{name: "IgnoreUnknown pattern", alias: "laptop.mac", text: "AppleThing 1", ok: true},
+		{name: "IgnoreUnknown out of scope", alias: "web", text: "AppleThing 1"},
+		{name: "Host is refused", alias: "web", text: "Host evil"},
+		{name: "empty value", alias: "web", text: "LocalForward"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExtras(tt.text, newKeywordPolicy(blocks, tt.alias, existing))
+			if (err == nil) != tt.ok {
+				t.Errorf("parseExtras(%q) error = %v, want ok %v", tt.text, err, tt.ok)
+			}
+		})
+	}
+}
+
+// editTestHost loads config, edits the form of alias (or a new host when
+// alias is empty) the way the editor does on save and returns the result.
+func editTestHost(t *testing.T, config, alias string, edit func(form *hostForm)) (string, error) {
+	t.Helper()
+	path, blocks := loadTestEntries(t, config)
+	entries := withoutGlobalBlocks(blocks)
+	var original *HostEntry
+	form := hostForm{Values: map[string]string{}}
+	if alias != "" {
+		entry, err := findHostEntry(entries, alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original = &entry
+		form = formFromEntry(original)
+		// The options area is read back and checked.
+		form.Extras, err = parseExtras(formatExtras(form.Extras), newKeywordPolicy(blocks, alias, form.Extras))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit(&form)
+	if err := validateHostForm(form, entries, original); err != nil {
+		return "", err
+	}
+	doc, err := parseConfigDocument(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyHostForm(doc, form, original); err != nil {
+		return "", err
+	}
+	return string(doc.Bytes()), nil
+}
+
+func TestApplyHostForm(t *testing.T) {
+	const config = "Host web\n    HostName w\n    User root\n    LocalForward 8080 localhost:80\n\nHost db\n"
+	tests := []struct {
+		name  string
+		alias string
+		edit  func(form *hostForm)
+		want  string
+	}{
+		{
+			name:  "unchanged",
+			alias: "web",
+			edit:  func(form *hostForm) {},
+			want:  config,
+		},
+		{
+			name:  "value changed in place",
+			alias: "web",
+			edit:  func(form *hostForm) { form.Values["HostName"] = "w.example.com" },
+			want:  "Host web\n    HostName w.example.com\n    User root\n    LocalForward 8080 localhost:80\n\nHost db\n",
+		},
+		{
+			name:  "field cleared and added",
+			alias: "web",
+			edit: func(form *hostForm) {
+				delete(form.Values, "User")
+				form.Values["Port"] = "2222"
+			},
+			want: "Host web\n    HostName w\n    LocalForward 8080 localhost:80\n    Port 2222\n\nHost db\n",
+		},
+		{
+			name:  "aliases changed",
+			alias: "web",
+			edit:  func(form *hostForm) { form.Patterns = []string{"web", "www"} },
+			want:  "Host web www\n    HostName w\n    User root\n    LocalForward 8080 localhost:80\n\nHost db\n",
+		},
+		{
+			name:  "extra options replaced",
+			alias: "web",
+			edit:  func(form *hostForm) { form.Extras = [][2]string{{"LocalForward", "9090 localhost:90"}} },
+			want:  "Host web\n    HostName w\n    User root\n    LocalForward 9090 localhost:90\n\nHost db\n",
+		},
+		{
+			name: "new host",
+			edit: func(form *hostForm) {
+				form.Patterns = []string{"cache"}
+				form.Values["HostName"] = "c"
+				form.Values["Port"] = "2222"
+			},
+			want: config + "\nHost cache\n    HostName c\n    Port 2222\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editTestHost(t, config, tt.alias, tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHostFormKeepsUnknownKeywords(t *testing.T) {
+	const config = "Host *\n    IgnoreUnknown UseKeychain\n\nHost web\n    HostName w\n    UseKeychain yes\n    NewerKeyword on\n"
+	tests := []struct {
+		name string
+		edit func(form *hostForm)
+		want string
+	}{
+		{
+			name: "unchanged",
+			edit: func(form *hostForm) {},
+			want: config,
+		},
+		{
+			name: "port added",
+			edit: func(form *hostForm) { form.Values["Port"] = "2222" },
+			want: "Host *\n    IgnoreUnknown UseKeychain\n\nHost web\n    HostName w\n    UseKeychain yes\n    NewerKeyword on\n    Port 2222\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editTestHost(t, config, "web", tt.edit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHostForm(t *testing.T) {
+	const config = "Host web\n    HostName w\n\nHost db db2\n\nHost db2\n\nHost *.prod\n"
+	tests := []struct {
+		name  string
+		alias string
+		edit  func(form *hostForm)
+		ok    bool
+	}{
+		{name: "unchanged", alias: "web", edit: func(form *hostForm) {}, ok: true},
+		{name: "no alias", alias: "web", edit: func(form *hostForm) { form.Patterns = nil }},
+		{name: "alias taken", alias: "web", edit: func(form *hostForm) { form.Patterns = []string{"web", "db"} }},
+		{name: "new host with a taken alias", edit: func(form *hostForm) { form.Patterns = []string{"cache", "web"} }},
+		{name: "shared alias kept", alias: "db", edit: func(form *hostForm) { form.Values["Port"] = "2222" }, ok: true},
+		{name: "shared wildcard", edit: func(form *hostForm) { form.Patterns = []string{"*.prod"} }, ok: true},
+		{name: "alias with a space", edit: func(form *hostForm) { form.Patterns = []string{"my host"} }},
+		{name: "alias with a quote", edit: func(form *hostForm) { form.Patterns = []string{`"x`} }},
+		{name: "HostName with a space", alias: "web", edit: func(form *hostForm) { form.Values["HostName"] = "a b" }},
+		{name: "port range", alias: "web", edit: func(form *hostForm) { form.Values["Port"] = "65536" }},
+		{name: "port not a number", alias: "web", edit: func(form *hostForm) { form.Values["Port"] = "ssh" }},
+		{name: "negative keepalive", alias: "web", edit: func(form *hostForm) { form.Values["ServerAliveInterval"] = "-1" }},
+		{name: "jump chain", alias: "web", edit: func(form *hostForm) { form.Values["ProxyJump"] = "a,ops@b:22" }, ok: true},
+		{name: "jump none", alias: "web", edit: func(form *hostForm) { form.Values["ProxyJump"] = "none" }, ok: true},
+		{name: "empty jump hop", alias: "web", edit: func(form *hostForm) { form.Values["ProxyJump"] = "a,,b" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := editTestHost(t, config, tt.alias, tt.edit)
+			if (err == nil) != tt.ok {
+				t.Errorf("error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
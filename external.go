@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// editorCommand builds the command that opens path at line in the user's
+// editor ($VISUAL, then $EDITOR, then vi), using each editor's own syntax for
+// jumping to a line.
+func editorCommand(path string, line int) (string, []string) {
+	editor := strings.TrimSpace(os.Getenv("VISUAL"))
+	if editor == "" {
+		editor = strings.TrimSpace(os.Getenv("EDITOR"))
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	fields := strings.Fields(editor)
+	name, args := fields[0], fields[1:]
+	if line < 1 {
+		return name, append(args, path)
+	}
+
+	switch filepath.Base(name) {
+	case "code", "code-insiders", "codium", "cursor":
+		// VS Code returns immediately unless asked to wait for the file.
+		hasWait := false
+		for _, a := range args {
+			if a == "-w" || a == "--wait" {
+				hasWait = true
+			}
+		}
+		if !hasWait {
+			args = append(args, "--wait")
+		}
+		return name, append(args, "--goto", fmt.Sprintf("%s:%d", path, line))
+	case "subl", "sublime_text", "hx", "helix", "zed":
+		return name, append(args, fmt.Sprintf("%s:%d", path, line))
+	case "vi", "vim", "nvim", "gvim", "mvim", "nano", "pico", "emacs", "emacsclient", "micro", "kak", "joe", "jed", "mg", "ne":
+		return name, append(args, fmt.Sprintf("+%d", line), path)
+	default:
+		return name, append(args, path)
+	}
+}
+
+// openInEditor suspends the TUI, edits the selected entry's file at its
+// Host/Match line, then reloads and keeps the same host selected.
+func (state *AppState) openInEditor() {
+	entry, ok := state.selectedEntry()
+	if !ok {
+		return
+	}
+	if entry.SourcePath == "" {
+		state.showMessageModal("Error", "unknown source file for this entry")
+		return
+	}
+
+	name, args := editorCommand(entry.SourcePath, entry.StartLine)
+	var runErr error
+	state.App.Suspend(func() {
+		cmd := exec.Command(name, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		runErr = cmd.Run()
+	})
+
+	state.reload()
+	selected := false
+	if len(entry.Patterns) > 0 {
+		selected = state.selectEntry(entry.SourcePath, entry.Patterns[0])
+	}
+	if !selected {
+		state.selectEntryAt(entry.SourcePath, entry.StartLine)
+	}
+	if runErr != nil {
+		state.showMessageModal("Editor Failed", fmt.Sprintf("%s: %v", name, runErr))
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sort modes of the host list, cycled with S. They order the list while no
+// fuzzy words rank it; pinned hosts stay on top either way.
+const (
+	sortConfig   = "config"
+	sortAlpha    = "alpha"
+	sortRecent   = "recent"
+	sortFrecency = "frecency"
+	sortCheck    = "check"
+)
+
+var sortModes = []string{sortConfig, sortAlpha, sortRecent, sortFrecency, sortCheck}
+
+func getPinsPath() string {
+	configPath := getAppConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "pins.json")
+}
+
+// loadPins reads the pinned aliases.
+func loadPins() map[string]bool {
+	pins := map[string]bool{}
+	path := getPinsPath()
+	if path == "" {
+		return pins
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return pins
+	}
+	aliases := []string{}
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return pins
+	}
+	for _, alias := range aliases {
+		pins[alias] = true
+	}
+	return pins
+}
+
+// savePins stores the pinned aliases as a sorted list.
+func savePins(pins map[string]bool) error {
+	path := getPinsPath()
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	aliases := []string{}
+	for alias, pinned := range pins {
+		if pinned {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (state *AppState) isPinned(entry HostEntry) bool {
+	return !entry.IsMatch() && len(entry.Patterns) > 0 && state.Pins[entry.Patterns[0]]
+}
+
+// togglePin pins or unpins the selected host and keeps it selected.
+func (state *AppState) togglePin() {
+	entry, ok := state.connectableEntry("pin")
+	if !ok {
+		return
+	}
+	if state.Pins == nil {
+		state.Pins = map[string]bool{}
+	}
+	alias := entry.Patterns[0]
+	if state.Pins[alias] {
+		delete(state.Pins, alias)
+	} else {
+		state.Pins[alias] = true
+	}
+	theme := state.currentTheme()
+	if err := savePins(state.Pins); err != nil {
+		state.setStatus(theme.MarkupError, fmt.Sprintf("Failed to save pins: %v", err))
+	} else if state.Pins[alias] {
+		state.setStatus(theme.MarkupAccent, fmt.Sprintf("Pinned %s", alias))
+	} else {
+		state.setStatus(theme.MarkupAccent, fmt.Sprintf("Unpinned %s", alias))
+	}
+	state.applyFilter(state.CurrentFilter)
+	state.selectEntry(entry.SourcePath, alias)
+}
+
+// cycleSort switches to the next sort mode and saves it.
+func (state *AppState) cycleSort() {
+	next := 0
+	for i, mode := range sortModes {
+		if mode == state.sortMode() {
+			next = (i + 1) % len(sortModes)
+		}
+	}
+	current, hasCurrent := state.selectedEntry()
+	state.Config.Sort = sortModes[next]
+	state.saveAppConfig()
+	state.applyFilter(state.CurrentFilter)
+	if hasCurrent {
+		state.selectEntry(current.SourcePath, firstPattern(current))
+	}
+	message := "Sorted by " + state.sortMode()
+	if len(state.Query.fuzzyWords()) > 0 {
+		message += " (search results stay ranked by match)"
+	}
+	state.setStatus(state.currentTheme().MarkupAccent, message)
+}
+
+func (state *AppState) sortMode() string {
+	if state.Config.Sort == "" {
+		return sortConfig
+	}
+	return state.Config.Sort
+}
+
+// frecencyScore weighs the connection count by how recent the last one was,
+// so a host used daily last month ranks below one used a few times today.
+func (state *AppState) frecencyScore(entry HostEntry) float64 {
+	record, ok := state.LastAccess[accessKey(entry)]
+	if !ok || record.Count == 0 {
+		return 0
+	}
+	last, err := time.Parse(time.RFC3339, record.LastAccess)
+	if err != nil {
+		return 0
+	}
+	weight := 10.0
+	switch age := time.Since(last); {
+	case age < 4*24*time.Hour:
+		weight = 100
+	case age < 14*24*time.Hour:
+		weight = 70
+	case age < 31*24*time.Hour:
+		weight = 50
+	case age < 90*24*time.Hour:
+		weight = 30
+	}
+	return float64(record.Count) * weight
+}
+
+// lastAccessTime is when entry was last connected to, or the zero time.
+func (state *AppState) lastAccessTime(entry HostEntry) time.Time {
+	t, _ := time.Parse(time.RFC3339, state.LastAccess[accessKey(entry)].LastAccess)
+	return t
+}
+
+// checkSortRank orders check results problems first, so a sweep with P
+// leaves the hosts that need attention on top.
+func checkSortRank(status CheckStatus) int {
+	switch status {
+	case CheckHostKeyChanged:
+		return 0
+	case CheckAuthFailed:
+		return 1
+	case CheckDNSFailed, CheckRefused, CheckJumpFailed, CheckUnreachable:
+		return 2
+	case CheckFailed:
+		return 3
+	case CheckTimeout:
+		return 4
+	case CheckOK:
+		return 5
+	case CheckRunning:
+		return 6
+	}
+	return 7
+}
+
+// sortEntries orders entries by the current sort mode. Entries that tie, or
+// that the mode knows nothing about, keep their config order.
+func (state *AppState) sortEntries(entries []HostEntry) []HostEntry {
+	var less func(a, b HostEntry) bool
+	switch state.sortMode() {
+	case sortAlpha:
+		less = func(a, b HostEntry) bool {
+			textA, _ := a.DisplayText()
+			textB, _ := b.DisplayText()
+			return strings.ToLower(textA) < strings.ToLower(textB)
+		}
+	case sortRecent:
+		less = func(a, b HostEntry) bool {
+			return state.lastAccessTime(a).After(state.lastAccessTime(b))
+		}
+	case sortFrecency:
+		less = func(a, b HostEntry) bool {
+			return state.frecencyScore(a) > state.frecencyScore(b)
+		}
+	case sortCheck:
+		less = func(a, b HostEntry) bool {
+			return checkSortRank(state.checkStatus(a)) < checkSortRank(state.checkStatus(b))
+		}
+	default:
+		return entries
+	}
+	sorted := append([]HostEntry{}, entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+func (state *AppState) checkStatus(entry HostEntry) CheckStatus {
+	if entry.IsMatch() || len(entry.Patterns) == 0 {
+		return CheckUnknown
+	}
+	return state.Checks[entry.Patterns[0]].Status
+}
+
+// pinnedFirst moves pinned hosts to the top, keeping the order within both
+// parts.
+func (state *AppState) pinnedFirst(entries []HostEntry) []HostEntry {
+	if len(state.Pins) == 0 {
+		return entries
+	}
+	pinned := []HostEntry{}
+	rest := []HostEntry{}
+	for _, entry := range entries {
+		if state.isPinned(entry) {
+			pinned = append(pinned, entry)
+		} else {
+			rest = append(rest, entry)
+		}
+	}
+	return append(pinned, rest...)
+}
+
+// formatSessionTime renders a cumulative session length such as "3h 12m".
+func formatSessionTime(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	if d < time.Minute {
+		return d.String()
+	}
+	hours := int64(d.Hours())
+	minutes := int64(d.Minutes()) % 60
+	if hours == 0 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// JumpHop is one host on the way to a target. Name is the hop as written in
+// ProxyJump or ProxyCommand and Host its host part, the name config blocks
+// are matched against; Address is where ssh ends up connecting after
+// applying that host's own config.
+type JumpHop struct {
+	Name    string
+	Host    string
+	User    string
+	Address string
+	Port    string
+	// Via is the directive that introduced the hop and where it was read.
+	Via        string
+	SourcePath string
+	Line       int
+	// Defined is true when a Host block other than a bare "*" matches Host.
+	Defined bool
+	// External marks an undefined Host that looks like a DNS name or
+	// address. ssh dials it as is, which is right unless the name is a typo
+	// of an alias.
+	External bool
+}
+
+// Status is how the hop relates to the config: "undefined", "external, not
+// defined here", or empty for a defined host.
+func (hop JumpHop) Status() string {
+	switch {
+	case hop.Defined:
+		return ""
+	case hop.External:
+		return "external, not defined here"
+	}
+	return "undefined"
+}
+
+// Label is the hop as ssh sees it, e.g. "alice@bastion.example:2222".
+func (hop JumpHop) Label() string {
+	label := hop.Address
+	if hop.User != "" {
+		label = hop.User + "@" + label
+	}
+	if hop.Port != "" && hop.Port != "22" {
+		label += ":" + hop.Port
+	}
+	return label
+}
+
+// JumpChain is the route to an alias: Hops in connection order, ending with
+// the alias itself. Problems lists cycles and undefined aliases.
+type JumpChain struct {
+	Hops     []JumpHop
+	Problems []string
+}
+
+// parseJumpSpec splits a ProxyJump hop in [user@]host[:port] or
+// ssh://[user@]host[:port] form.
+func parseJumpSpec(spec string) (user, host, port string) {
+	host = strings.TrimPrefix(spec, "ssh://")
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		user, host = host[:i], host[i+1:]
+	}
+	if strings.HasPrefix(host, "[") {
+		if end := strings.Index(host, "]"); end > 0 {
+			rest := host[end+1:]
+			host = host[1:end]
+			port = strings.TrimPrefix(rest, ":")
+		}
+		return user, host, port
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 && strings.Count(host, ":") == 1 {
+		host, port = host[:i], host[i+1:]
+	}
+	return user, host, port
+}
+
+// proxyCommandJump returns the hop of a legacy "ssh ... -W %h:%p host"
+// ProxyCommand, or false for any other command.
+func proxyCommandJump(command string) (string, bool) {
+	args := splitArgs(command)
+	if len(args) == 0 || filepath.Base(args[0]) != "ssh" {
+		return "", false
+	}
+	// ssh options that take an argument; the hop is the first other operand.
+	withValue := "BbcDEeFIiJLlmOoPpQRSWw"
+	forwarding, user, port, host := false, "", "", ""
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+			flag := arg[len(arg)-1:]
+			if !strings.Contains(withValue, flag) || i+1 >= len(args) {
+				continue
+			}
+			value := args[i+1]
+			i++
+			switch flag {
+			case "W":
+				forwarding = true
+			case "l":
+				user = value
+			case "p":
+				port = value
+			}
+			continue
+		}
+		if host == "" {
+			host = arg
+		}
+	}
+	if !forwarding || host == "" {
+		return "", false
+	}
+	if user != "" && !strings.Contains(host, "@") {
+		host = user + "@" + host
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return host, true
+}
+
+// jumpDirective returns the proxy setting ssh would use for an alias. Of
+// ProxyJump and ProxyCommand, whichever is set first wins.
+func jumpDirective(cfg EffectiveConfig) (EffectiveOption, []string) {
+	for _, opt := range cfg.Options {
+		switch strings.ToLower(opt.Key) {
+		case "proxyjump":
+			if strings.EqualFold(opt.Value, "none") {
+				return opt, nil
+			}
+			hops := []string{}
+			for _, hop := range strings.Split(opt.Value, ",") {
+				if hop = strings.TrimSpace(hop); hop != "" {
+					hops = append(hops, hop)
+				}
+			}
+			return opt, hops
+		case "proxycommand":
+			if hop, ok := proxyCommandJump(opt.Value); ok {
+				return opt, []string{hop}
+			}
+			return opt, nil
+		}
+	}
+	return EffectiveOption{}, nil
+}
+
+// isExternalHost reports whether name is evidently a DNS name or address
+// rather than an alias.
+func isExternalHost(name string) bool {
+	return strings.Contains(name, ".") || net.ParseIP(name) != nil || name == "localhost"
+}
+
+// isDefinedHost reports whether a Host block other than a bare "*" matches
+// name.
+func isDefinedHost(blocks []HostEntry, name string) bool {
+	for _, block := range blocks {
+		if block.Kind != BlockHost || len(block.Patterns) == 1 && block.Patterns[0] == "*" {
+			continue
+		}
+		if hostPatternsMatch(block.Patterns, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveJumpChain follows ProxyJump and ProxyCommand from alias back to
+// the first host dialed directly. As in ssh, only the first hop of a
+// "a,b" list is reached through its own proxy settings; later hops are
+// connected through the ones before them.
+func resolveJumpChain(blocks []HostEntry, alias string) JumpChain {
+	chain := JumpChain{}
+	chain.Hops = chain.route(blocks, alias, JumpHop{}, []string{})
+	return chain
+}
+
+// route returns the hops to spec followed by spec itself. stack holds the
+// hosts being resolved, to detect cycles.
+func (chain *JumpChain) route(blocks []HostEntry, spec string, hop JumpHop, stack []string) []JumpHop {
+	hop, cfg := chain.describeHop(blocks, spec, hop)
+	_, host, _ := parseJumpSpec(spec)
+	if chain.closesCycle(stack, host) {
+		return []JumpHop{hop}
+	}
+	stack = append(stack, host)
+
+	directive, jumps := jumpDirective(cfg)
+	if len(jumps) == 0 {
+		return []JumpHop{hop}
+	}
+	via := JumpHop{Via: directive.Key, SourcePath: directive.SourcePath, Line: directive.Line}
+	hops := chain.route(blocks, jumps[0], via, stack)
+	// Later hops are reached with a command line -J, which overrides their
+	// own proxy settings, so they are not followed further.
+	for _, next := range jumps[1:] {
+		nextHop, _ := chain.describeHop(blocks, next, via)
+		_, nextHost, _ := parseJumpSpec(next)
+		if chain.closesCycle(stack, nextHost) {
+			break
+		}
+		hops = append(hops, nextHop)
+	}
+	return append(hops, hop)
+}
+
+// describeHop fills in where spec connects to from its own config.
+func (chain *JumpChain) describeHop(blocks []HostEntry, spec string, hop JumpHop) (JumpHop, EffectiveConfig) {
+	user, host, port := parseJumpSpec(spec)
+	cfg := resolveEffectiveConfig(blocks, host)
+	hop.Name, hop.Host, hop.User, hop.Address, hop.Port = spec, host, user, host, port
+	hop.Defined = isDefinedHost(blocks, host)
+	hop.External = !hop.Defined && isExternalHost(host)
+	if v, ok := cfg.Get("HostName"); ok {
+		hop.Address = v.Value
+	}
+	if v, ok := cfg.Get("User"); ok && hop.User == "" {
+		hop.User = v.Value
+	}
+	if v, ok := cfg.Get("Port"); ok && hop.Port == "" {
+		hop.Port = v.Value
+	}
+	if !hop.Defined && !hop.External {
+		chain.Problems = append(chain.Problems, fmt.Sprintf("%s is not defined in the config", host))
+	}
+	return hop, cfg
+}
+
+// closesCycle records a problem when host is already on the route.
+func (chain *JumpChain) closesCycle(stack []string, host string) bool {
+	for _, seen := range stack {
+		if seen == host {
+			chain.Problems = append(chain.Problems, fmt.Sprintf("cycle: %s → %s", strings.Join(stack, " → "), host))
+			return true
+		}
+	}
+	return false
+}
+
+// localNodeName names the machine chains start from.
+func localNodeName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// renderJumpChain draws the route to an alias as a tree below row and
+// returns the next free row. Direct connections draw nothing.
+func (state *AppState) renderJumpChain(row int, chain JumpChain) int {
+	if len(chain.Hops) < 2 && len(chain.Problems) == 0 {
+		return row
+	}
+	theme := state.currentTheme()
+	header := tview.NewTableCell(fmt.Sprintf("[::b][%s]Jump chain[-:-:-]", theme.MarkupAccent))
+	header.SetSelectable(false)
+	state.DetailTable.SetCell(row, 0, header)
+	row++
+
+	setRow := func(text string, color tcell.Color, source string) {
+		cell := tview.NewTableCell(text)
+		cell.SetTextColor(color)
+		cell.SetExpansion(1)
+		state.DetailTable.SetCell(row, 1, cell)
+		if source != "" {
+			sourceCell := tview.NewTableCell(tview.Escape(source))
+			sourceCell.SetTextColor(theme.Muted)
+			state.DetailTable.SetCell(row, 2, sourceCell)
+		}
+		row++
+	}
+	setRow(tview.Escape(localNodeName()), theme.Muted, "")
+	for i, hop := range chain.Hops {
+		text := strings.Repeat("   ", i) + "└─ " + tview.Escape(hop.Name)
+		if label := hop.Label(); label != hop.Name {
+			text += fmt.Sprintf(" [%s](%s)[-]", mutedMarkup(theme), tview.Escape(label))
+		}
+		if status := hop.Status(); status != "" {
+			text += fmt.Sprintf(" [%s]%s[-]", theme.MarkupWarning, status)
+		}
+		source := ""
+		if hop.SourcePath != "" {
+			source = fmt.Sprintf("%s %s", hop.Via, state.sourceLabel(hop.SourcePath, hop.Line))
+		}
+		setRow(text, theme.Text, source)
+	}
+	for _, problem := range chain.Problems {
+		setRow(fmt.Sprintf("[%s]%s[-]", theme.MarkupError, tview.Escape(problem)), theme.Text, "")
+	}
+	return row + 1
+}
+
+// jumpEdge is a link of the topology: From connects onward to To.
+type jumpEdge struct {
+	From, To string
+}
+
+// jumpTopology collects the chains of every concrete alias into edges
+// between host names, with the local machine as the root, the status of
+// hosts no block defines, and the problems found on the way.
+func jumpTopology(blocks []HostEntry, aliases []string) (string, []jumpEdge, map[string]string, []string) {
+	root := localNodeName()
+	edges := []jumpEdge{}
+	seenEdge := map[jumpEdge]bool{}
+	unknown := map[string]string{}
+	problems := []string{}
+	seenProblem := map[string]bool{}
+	for _, alias := range aliases {
+		chain := resolveJumpChain(blocks, alias)
+		from := root
+		for _, hop := range chain.Hops {
+			edge := jumpEdge{From: from, To: hop.Host}
+			if !seenEdge[edge] && edge.From != edge.To {
+				seenEdge[edge] = true
+				edges = append(edges, edge)
+			}
+			if status := hop.Status(); status != "" {
+				unknown[hop.Host] = status
+			}
+			from = hop.Host
+		}
+		for _, problem := range chain.Problems {
+			if !seenProblem[problem] {
+				seenProblem[problem] = true
+				problems = append(problems, problem)
+			}
+		}
+	}
+	return root, edges, unknown, problems
+}
+
+// handleGraph implements: 55h graph [--text | --dot]
+func handleGraph(inv *cliInvocation) error {
+	if len(inv.Args) > 0 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	dot := inv.Has("dot") && !inv.Has("text")
+	configPath := inv.ConfigPath
+	blocks, err := loadSSHConfigBlocks(configPath)
+	if err != nil {
+		return err
+	}
+	root, edges, unknown, problems := jumpTopology(blocks, checkTargets(withoutGlobalBlocks(blocks)))
+
+	if dot {
+		fmt.Println("digraph ssh {")
+		fmt.Println("  rankdir=LR;")
+		fmt.Printf("  %s [shape=box];\n", strconv.Quote(root))
+		names := []string{}
+		for name := range unknown {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			color := "red"
+			if unknown[name] != "undefined" {
+				color = "gray"
+			}
+			fmt.Printf("  %s [style=dashed, color=%s];\n", strconv.Quote(name), color)
+		}
+		for _, edge := range edges {
+			fmt.Printf("  %s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+		}
+		fmt.Println("}")
+	} else {
+		children := map[string][]string{}
+		for _, edge := range edges {
+			children[edge.From] = append(children[edge.From], edge.To)
+		}
+		fmt.Println(root)
+		var walk func(name, prefix string, seen map[string]bool)
+		walk = func(name, prefix string, seen map[string]bool) {
+			kids := children[name]
+			for i, kid := range kids {
+				branch, next := "├── ", "│   "
+				if i == len(kids)-1 {
+					branch, next = "└── ", "    "
+				}
+				label := kid
+				if status := unknown[kid]; status != "" {
+					label += " (" + status + ")"
+				}
+				if seen[kid] {
+					fmt.Println(prefix + branch + label + " (cycle)")
+					continue
+				}
+				fmt.Println(prefix + branch + label)
+				seen[kid] = true
+				walk(kid, prefix+next, seen)
+				delete(seen, kid)
+			}
+		}
+		walk(root, "", map[string]bool{root: true})
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, "warning: "+problem)
+	}
+	return nil
+}
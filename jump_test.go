@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseJumpSpec(t *testing.T) {
+	tests := []struct {
+		spec             string
+		user, host, port string
+	}{
+		{"bastion", "", "bastion", ""},
+		{"bastion:2222", "", "bastion", "2222"},
+		{"alice@bastion", "alice", "bastion", ""},
+		{"alice@bastion:2222", "alice", "bastion", "2222"},
+		{"ssh://alice@bastion:2222", "alice", "bastion", "2222"},
+		{"ssh://bastion", "", "bastion", ""},
+		{"alice@corp@bastion", "alice@corp", "bastion", ""},
+		{"10.0.0.1:22", "", "10.0.0.1", "22"},
+		{"[::1]:2222", "", "::1", "2222"},
+		{"alice@[fe80::1]", "alice", "fe80::1", ""},
+		{"fe80::1", "", "fe80::1", ""},
+	}
+	for _, tt := range tests {
+		user, host, port := parseJumpSpec(tt.spec)
+		if user != tt.user || host != tt.host || port != tt.port {
+			t.Errorf("parseJumpSpec(%q) = %q, %q, %q, want %q, %q, %q", tt.spec, user, host, port, tt.user, tt.host, tt.port)
+		}
+	}
+}
+
+func TestProxyCommandJump(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+		ok      bool
+	}{
+		{"ssh -W %h:%p bastion", "bastion", true},
+		{"/usr/bin/ssh -q -W %h:%p alice@bastion", "alice@bastion", true},
+		{"ssh -l alice -p 2222 -W %h:%p bastion", "alice@bastion:2222", true},
+		{"ssh -W %h:%p -l alice bob@bastion", "bob@bastion", true},
+		{"ssh bastion nc %h %p", "", false},
+		{"nc -X connect -x proxy:8080 %h %p", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := proxyCommandJump(tt.command)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("proxyCommandJump(%q) = %q, %v, want %q, %v", tt.command, got, ok, tt.want, tt.ok)
+		}
+	}
+}
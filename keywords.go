@@ -0,0 +1,96 @@
+package main
+
+import "strings"
+
+// sshKeywords lists the ssh_config(5) keywords in their documented spelling.
+var sshKeywords = []string{
+	"AddKeysToAgent", "AddressFamily", "BatchMode", "BindAddress", "BindInterface",
+	"CanonicalDomains", "CanonicalizeFallbackLocal", "CanonicalizeHostname",
+	"CanonicalizeMaxDots", "CanonicalizePermittedCNAMEs", "CASignatureAlgorithms",
+	"CertificateFile", "ChannelTimeout", "CheckHostIP", "Ciphers", "ClearAllForwardings",
+	"Compression", "ConnectionAttempts", "ConnectTimeout", "ControlMaster", "ControlPath",
+	"ControlPersist", "DynamicForward", "EnableEscapeCommandline", "EnableSSHKeysign",
+	"EscapeChar", "ExitOnForwardFailure", "FingerprintHash", "ForkAfterAuthentication",
+	"ForwardAgent", "ForwardX11", "ForwardX11Timeout", "ForwardX11Trusted",
+	"GatewayPorts", "GlobalKnownHostsFile", "GSSAPIAuthentication",
+	"GSSAPIDelegateCredentials", "HashKnownHosts", "Host", "HostbasedAcceptedAlgorithms",
+	"HostbasedAuthentication", "HostKeyAlgorithms", "HostKeyAlias", "HostName",
+	"IdentitiesOnly", "IdentityAgent", "IdentityFile", "IgnoreUnknown", "Include",
+	"IPQoS", "KbdInteractiveAuthentication", "KbdInteractiveDevices", "KexAlgorithms",
+	"KnownHostsCommand", "LocalCommand", "LocalForward", "LogLevel", "LogVerbose", "MACs",
+	"Match", "NoHostAuthenticationForLocalhost", "NumberOfPasswordPrompts",
+	"ObscureKeystrokeTiming", "PasswordAuthentication", "PermitLocalCommand",
+	"PermitRemoteOpen", "PKCS11Provider", "Port", "PreferredAuthentications",
+	"ProxyCommand", "ProxyJump", "ProxyUseFdpass", "PubkeyAcceptedAlgorithms",
+	"PubkeyAuthentication", "RekeyLimit", "RemoteCommand", "RemoteForward",
+	"RequestTTY", "RequiredRSASize", "RevokedHostKeys", "SecurityKeyProvider",
+	"SendEnv", "ServerAliveCountMax", "ServerAliveInterval", "SessionType", "SetEnv",
+	"StdinNull", "StreamLocalBindMask", "StreamLocalBindUnlink", "StrictHostKeyChecking",
+	"SyslogFacility", "Tag", "TCPKeepAlive", "Tunnel", "TunnelDevice", "UpdateHostKeys",
+	"User", "UserKnownHostsFile", "VerifyHostKeyDNS", "VisualHostKey", "XAuthLocation",
+}
+
+var sshKeywordIndex = func() map[string]string {
+	index := make(map[string]string, len(sshKeywords))
+	for _, k := range sshKeywords {
+		index[strings.ToLower(k)] = k
+	}
+	return index
+}()
+
+// multiValueKeywords may appear several times and every occurrence applies,
+// unlike ordinary options where the first obtained value wins.
+var multiValueKeywords = map[string]bool{
+	"certificatefile": true,
+	"dynamicforward":  true,
+	"identityfile":    true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"sendenv":         true,
+	"setenv":          true,
+}
+
+// canonicalKeyword returns the documented spelling of a keyword, or the
+// keyword as written when it is not a known ssh_config option.
+func canonicalKeyword(key string) string {
+	if k, ok := sshKeywordIndex[strings.ToLower(key)]; ok {
+		return k
+	}
+	return key
+}
+
+// keywordPolicy decides which keywords outside sshKeywords a host may carry:
+// those an IgnoreUnknown in scope covers, and those the block already has,
+// since a newer ssh may know keywords this list doesn't.
+type keywordPolicy struct {
+	existing map[string]bool
+	ignored  []string
+}
+
+// newKeywordPolicy builds the policy for alias from the loaded blocks and the
+// options the block already has.
+func newKeywordPolicy(blocks []HostEntry, alias string, existing [][2]string) keywordPolicy {
+	policy := keywordPolicy{existing: map[string]bool{}}
+	for _, opt := range existing {
+		policy.existing[strings.ToLower(opt[0])] = true
+	}
+	if alias != "" {
+		if opt, ok := resolveEffectiveConfig(blocks, alias).Get("IgnoreUnknown"); ok {
+			for _, p := range strings.Split(opt.Value, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					policy.ignored = append(policy.ignored, p)
+				}
+			}
+		}
+	}
+	return policy
+}
+
+// accepts reports whether ssh would take key under this policy.
+func (policy keywordPolicy) accepts(key string) bool {
+	lower := strings.ToLower(key)
+	if _, known := sshKeywordIndex[lower]; known || policy.existing[lower] {
+		return true
+	}
+	return len(policy.ignored) > 0 && hostPatternsMatch(policy.ignored, key)
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rivo/tview"
+)
+
+// latencyHistorySize is how many successful checks are kept per host.
+const latencyHistorySize = 20
+
+// HopTiming is when ssh finished authenticating to one host of a chain,
+// measured from the start of the check. The last hop is the target.
+type HopTiming struct {
+	Host    string   `json:"host"`
+	Elapsed Duration `json:"elapsed"`
+}
+
+// LatencySample is one successful check in a host's latency history.
+type LatencySample struct {
+	At      time.Time `json:"at"`
+	Connect Duration  `json:"connect,omitempty"`
+	Total   Duration  `json:"total"`
+}
+
+// stampedLine is a stderr line with the time it arrived after the start of
+// the check.
+type stampedLine struct {
+	At   time.Duration
+	Text string
+}
+
+// stderrRecorder timestamps each line ssh writes to stderr, so that the
+// debug messages of -v can be turned into connection timings.
+type stderrRecorder struct {
+	start   time.Time
+	mu      sync.Mutex
+	partial []byte
+	lines   []stampedLine
+}
+
+func (r *stderrRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	at := time.Since(r.start)
+	r.partial = append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(r.partial, '\n')
+		if i < 0 {
+			break
+		}
+		r.lines = append(r.lines, stampedLine{At: at, Text: strings.TrimSpace(string(r.partial[:i]))})
+		r.partial = r.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Lines returns everything recorded, including an unterminated last line.
+func (r *stderrRecorder) Lines() []stampedLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := append([]stampedLine{}, r.lines...)
+	if tail := strings.TrimSpace(string(r.partial)); tail != "" {
+		lines = append(lines, stampedLine{At: time.Since(r.start), Text: tail})
+	}
+	return lines
+}
+
+// isVerboseLine reports whether a stderr line is -v chatter rather than
+// something ssh would also print without it.
+func isVerboseLine(line string) bool {
+	for _, prefix := range []string{"debug", "OpenSSH_", "Authenticated to ", "Transferred: ", "Bytes per second: "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionTimings reads the TCP connect time of the first host ssh dials
+// and the authentication time of every hop from -v output. ProxyJump hops
+// run their own ssh -v, so their messages are interleaved in order.
+func connectionTimings(lines []stampedLine) (time.Duration, []HopTiming) {
+	var connect time.Duration
+	var connecting time.Duration = -1
+	hops := []HopTiming{}
+	for _, line := range lines {
+		text := strings.TrimPrefix(line.Text, "debug1: ")
+		switch {
+		case strings.HasPrefix(text, "Connecting to "):
+			if connect == 0 {
+				connecting = line.At
+			}
+		case strings.HasPrefix(text, "Connection established"):
+			if connect == 0 && connecting >= 0 {
+				connect = line.At - connecting
+			}
+		case strings.HasPrefix(text, "Authenticated to "):
+			host := strings.TrimPrefix(text, "Authenticated to ")
+			if i := strings.IndexAny(host, " ("); i > 0 {
+				host = host[:i]
+			}
+			hops = append(hops, HopTiming{Host: host, Elapsed: Duration(line.At)})
+		}
+	}
+	if len(hops) == 0 {
+		hops = nil
+	}
+	return connect, hops
+}
+
+// slowestHop returns the index of the hop that added the most time, or -1
+// for direct connections.
+func slowestHop(hops []HopTiming) int {
+	if len(hops) < 2 {
+		return -1
+	}
+	slowest, worst := -1, time.Duration(-1)
+	var prev time.Duration
+	for i, hop := range hops {
+		if d := time.Duration(hop.Elapsed) - prev; d > worst {
+			slowest, worst = i, d
+		}
+		prev = time.Duration(hop.Elapsed)
+	}
+	return slowest
+}
+
+// hopsText renders a chain as "bastion +120ms → web +80ms", highlighting
+// the slowest step.
+func hopsText(hops []HopTiming, highlight string) string {
+	slowest := slowestHop(hops)
+	parts := []string{}
+	var prev time.Duration
+	for i, hop := range hops {
+		step := time.Duration(hop.Elapsed) - prev
+		prev = time.Duration(hop.Elapsed)
+		part := fmt.Sprintf("%s +%s", tview.Escape(hop.Host), step.Round(time.Millisecond))
+		if i == slowest {
+			part = fmt.Sprintf("[%s]%s[-]", highlight, part)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " → ")
+}
+
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the total times of samples, oldest first, scaled between
+// their minimum and maximum.
+func sparkline(samples []LatencySample) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	lo, hi := samples[0].Total, samples[0].Total
+	for _, s := range samples {
+		if s.Total < lo {
+			lo = s.Total
+		}
+		if s.Total > hi {
+			hi = s.Total
+		}
+	}
+	var b strings.Builder
+	for _, s := range samples {
+		level := 0
+		if hi > lo {
+			level = int(float64(s.Total-lo) / float64(hi-lo) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	return b.String()
+}
+
+// appendLatency adds a successful result to the history of alias, keeping
+// the most recent latencyHistorySize samples.
+func appendLatency(history map[string][]LatencySample, alias string, result CheckResult) {
+	if result.Status != CheckOK {
+		return
+	}
+	samples := append(history[alias], LatencySample{
+		At:      result.CheckedAt,
+		Connect: result.Connect,
+		Total:   result.Duration,
+	})
+	if len(samples) > latencyHistorySize {
+		samples = samples[len(samples)-latencyHistorySize:]
+	}
+	history[alias] = samples
+}
+
+func getLatencyLogPath() string {
+	configPath := getAppConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "latency.json")
+}
+
+func loadLatencyLog() map[string][]LatencySample {
+	history := map[string][]LatencySample{}
+	path := getLatencyLogPath()
+	if path == "" {
+		return history
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return history
+	}
+	_ = json.Unmarshal(data, &history)
+	return history
+}
+
+func saveLatencyLog(history map[string][]LatencySample) error {
+	path := getLatencyLogPath()
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (state *AppState) loadLatency() {
+	state.Latency = loadLatencyLog()
+}
+
+func (state *AppState) saveLatency() {
+	_ = saveLatencyLog(state.Latency)
+}
+
+// latencySummary is the Details line for a host: the last total and TCP
+// connect time followed by the history sparkline.
+func (state *AppState) latencySummary(alias string) string {
+	samples := state.Latency[alias]
+	if len(samples) == 0 {
+		return ""
+	}
+	last := samples[len(samples)-1]
+	text := time.Duration(last.Total).Round(time.Millisecond).String()
+	if last.Connect > 0 {
+		text += fmt.Sprintf(" (tcp %s)", time.Duration(last.Connect).Round(time.Millisecond))
+	}
+	if len(samples) > 1 {
+		text += fmt.Sprintf("  [%s]%s[-]", state.currentTheme().MarkupAccent, sparkline(samples))
+	}
+	return text
+}
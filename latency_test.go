@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConnectionTimings(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		lines   []stampedLine
+		connect time.Duration
+		hops    []HopTiming
+	}{
+		{
+			name: "direct",
+			lines: []stampedLine{
+				{At: 1 * ms, Text: "OpenSSH_9.6p1, OpenSSL 3.0.13 30 Jan 2024"},
+				{At: 2 * ms, Text: "debug1: Connecting to web.example.com [10.0.0.1] port 22."},
+				{At: 32 * ms, Text: "debug1: Connection established."},
+				{At: 90 * ms, Text: `Authenticated to web.example.com ([10.0.0.1]:22) using "publickey".`},
+			},
+			connect: 30 * ms,
+			hops:    []HopTiming{{Host: "web.example.com", Elapsed: Duration(90 * ms)}},
+		},
+		{
+			name: "jump chain",
+			lines: []stampedLine{
+				{At: 1 * ms, Text: "debug1: Executing proxy command: exec ssh -v -W '[web]:22' bastion"},
+				{At: 3 * ms, Text: "debug1: Connecting to bastion.example.com [10.0.0.9] port 22."},
+				{At: 13 * ms, Text: "debug1: Connection established."},
+				{At: 60 * ms, Text: `Authenticated to bastion.example.com ([10.0.0.9]:22) using "publickey".`},
+				{At: 61 * ms, Text: "debug1: channel_connect_stdio_fwd: web:22"},
+				{At: 150 * ms, Text: `Authenticated to web (via proxy) using "publickey".`},
+			},
+			connect: 10 * ms,
+			hops: []HopTiming{
+				{Host: "bastion.example.com", Elapsed: Duration(60 * ms)},
+				{Host: "web", Elapsed: Duration(150 * ms)},
+			},
+		},
+		{
+			name: "only the first connection is timed",
+			lines: []stampedLine{
+				{At: 0, Text: "debug1: Connecting to a [10.0.0.1] port 22."},
+				{At: 5 * ms, Text: "debug1: Connection established."},
+				{At: 6 * ms, Text: "debug1: Connecting to b [10.0.0.2] port 22."},
+				{At: 50 * ms, Text: "debug1: Connection established."},
+			},
+			connect: 5 * ms,
+		},
+		{
+			name: "connection refused",
+			lines: []stampedLine{
+				{At: 1 * ms, Text: "debug1: Connecting to web [10.0.0.1] port 22."},
+				{At: 2 * ms, Text: "debug1: connect to address 10.0.0.1 port 22: Connection refused"},
+			},
+		},
+		{
+			name: "no output",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connect, hops := connectionTimings(tt.lines)
+			if connect != tt.connect {
+				t.Errorf("connect = %v, want %v", connect, tt.connect)
+			}
+			if !reflect.DeepEqual(hops, tt.hops) {
+				t.Errorf("hops = %+v, want %+v", hops, tt.hops)
+			}
+		})
+	}
+}
+
+func TestSlowestHop(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		hops []HopTiming
+		want int
+	}{
+		{name: "direct", hops: []HopTiming{{Host: "web", Elapsed: Duration(90 * ms)}}, want: -1},
+		{
+			name: "first hop",
+			hops: []HopTiming{{Host: "bastion", Elapsed: Duration(100 * ms)}, {Host: "web", Elapsed: Duration(150 * ms)}},
+			want: 0,
+		},
+		{
+			name: "last hop",
+			hops: []HopTiming{{Host: "bastion", Elapsed: Duration(40 * ms)}, {Host: "web", Elapsed: Duration(150 * ms)}},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slowestHop(tt.hops); got != tt.want {
+				t.Errorf("slowestHop = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// listFields are the columns 55h list knows besides ssh keywords, in the
+// order --fields=all prints them.
+var listFields = []string{
+	"alias", "patterns", "hostname", "user", "port", "identityfile", "proxyjump",
+	"tags", "owner", "note",
+	"file", "line", "end_line", "last_access", "last_session_end",
+	"access_count", "first_access", "session_seconds", "pinned",
+	"check", "check_summary", "checked_at", "latency",
+}
+
+var defaultListFields = []string{"alias", "hostname", "user", "port", "proxyjump", "file", "line", "last_access", "check"}
+
+var listFormats = []string{"table", "json", "jsonl", "csv", "yaml"}
+
+// listRecord is one host as 55h list prints it: values in field order, nil
+// where the host has no value.
+type listRecord []any
+
+// listValue returns a field of entry. Names that are not list fields are
+// read as ssh keywords from the block; repeated keywords are joined by ",".
+func (state *AppState) listValue(entry HostEntry, field string) any {
+	alias := ""
+	if len(entry.Patterns) > 0 {
+		alias = entry.Patterns[0]
+	}
+	check, checked := state.Checks[alias]
+	access := state.LastAccess[accessKey(entry)]
+	switch field {
+	case "alias":
+		return alias
+	case "patterns":
+		return strings.Join(entry.Patterns, " ")
+	case "hostname":
+		return nonEmpty(entry.HostName)
+	case "user":
+		return nonEmpty(entry.User)
+	case "port":
+		return nonEmpty(entry.Port)
+	case "identityfile":
+		return nonEmpty(strings.Join(entry.OptionValues("IdentityFile"), ","))
+	case "proxyjump":
+		return nonEmpty(entry.ProxyJump)
+	case "tags", "owner", "note":
+		return nonEmpty(entry.Meta.Get(field))
+	case "file":
+		return nonEmpty(entry.SourcePath)
+	case "line":
+		return entry.StartLine
+	case "end_line":
+		return entry.EndLine
+	case "last_access":
+		return nonEmpty(access.LastAccess)
+	case "last_session_end":
+		return nonEmpty(access.LastSessionEnd)
+	case "access_count":
+		return access.Count
+	case "first_access":
+		return nonEmpty(access.FirstAccess)
+	case "session_seconds":
+		return access.SessionSeconds
+	case "pinned":
+		return state.isPinned(entry)
+	case "check":
+		if !checked {
+			return nil
+		}
+		return check.Status.String()
+	case "check_summary":
+		if !checked {
+			return nil
+		}
+		return nonEmpty(check.Summary)
+	case "checked_at":
+		if !checked {
+			return nil
+		}
+		return check.CheckedAt.Format(time.RFC3339)
+	case "latency":
+		samples := state.Latency[alias]
+		if len(samples) == 0 {
+			return nil
+		}
+		return time.Duration(samples[len(samples)-1].Total).Round(time.Millisecond).String()
+	}
+	return nonEmpty(strings.Join(entry.OptionValues(field), ","))
+}
+
+func nonEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// parseListFields expands a comma-separated --fields value.
+func parseListFields(value string) ([]string, error) {
+	if value == "all" {
+		return listFields, nil
+	}
+	known := map[string]bool{}
+	for _, f := range listFields {
+		known[f] = true
+	}
+	fields := []string{}
+	for _, f := range strings.Split(value, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" {
+			continue
+		}
+		if !known[f] {
+			if _, ok := sshKeywordIndex[f]; !ok {
+				return nil, fmt.Errorf("unknown field %q (fields: %s, or any ssh_config keyword)", f, strings.Join(listFields, ", "))
+			}
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields selected")
+	}
+	return fields, nil
+}
+
+// handleList implements: 55h list [query] [-f fields] [-o format]
+// The query uses the search box syntax; hosts stay in config order.
+func handleList(inv *cliInvocation) error {
+	fields := defaultListFields
+	if inv.Has("fields") {
+		parsed, err := parseListFields(inv.Value("fields"))
+		if err != nil {
+			return err
+		}
+		fields = parsed
+	}
+	format := "table"
+	if inv.Has("output") {
+		format = inv.Value("output")
+	}
+	query, err := parseHostQuery(strings.Join(inv.Args, " "))
+	if err != nil {
+		return fmt.Errorf("bad query: %v", err)
+	}
+	configPath := inv.ConfigPath
+
+	entries, err := loadSSHConfig(configPath)
+	if err != nil {
+		return err
+	}
+	state := &AppState{ConfigPath: configPath}
+	state.loadAccessLog()
+	state.loadChecks()
+	state.loadLatency()
+	state.Pins = loadPins()
+	state.Config.Sort = inv.Value("sort")
+
+	records := []listRecord{}
+	for _, entry := range state.sortEntries(entries) {
+		if entry.IsMatch() || !query.Match(entry) {
+			continue
+		}
+		record := make(listRecord, len(fields))
+		for i, field := range fields {
+			record[i] = state.listValue(entry, field)
+		}
+		records = append(records, record)
+	}
+	return writeList(os.Stdout, format, fields, records)
+}
+
+func writeList(w io.Writer, format string, fields []string, records []listRecord) error {
+	switch format {
+	case "json":
+		fmt.Fprint(w, "[")
+		for i, record := range records {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprint(w, "\n  ")
+			if err := writeJSONObject(w, fields, record); err != nil {
+				return err
+			}
+		}
+		if len(records) > 0 {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprintln(w, "]")
+	case "jsonl":
+		for _, record := range records {
+			if err := writeJSONObject(w, fields, record); err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+		}
+	case "csv":
+		out := csv.NewWriter(w)
+		_ = out.Write(fields)
+		for _, record := range records {
+			row := make([]string, len(record))
+			for i, v := range record {
+				row[i] = listText(v)
+			}
+			_ = out.Write(row)
+		}
+		out.Flush()
+		return out.Error()
+	case "yaml":
+		if len(records) == 0 {
+			fmt.Fprintln(w, "[]")
+		}
+		for _, record := range records {
+			for i, field := range fields {
+				prefix := "  "
+				if i == 0 {
+					prefix = "- "
+				}
+				fmt.Fprintf(w, "%s%s: %s\n", prefix, field, yamlScalar(record[i]))
+			}
+		}
+	default:
+		out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := make([]string, len(fields))
+		for i, field := range fields {
+			header[i] = strings.ToUpper(field)
+		}
+		fmt.Fprintln(out, strings.Join(header, "\t"))
+		for _, record := range records {
+			row := make([]string, len(record))
+			for i, v := range record {
+				row[i] = listText(v)
+			}
+			fmt.Fprintln(out, strings.Join(row, "\t"))
+		}
+		return out.Flush()
+	}
+	return nil
+}
+
+// writeJSONObject writes one record as a JSON object with keys in field
+// order.
+func writeJSONObject(w io.Writer, fields []string, record listRecord) error {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		value, err := json.Marshal(record[i])
+		if err != nil {
+			return err
+		}
+		parts[i] = strconv.Quote(field) + ":" + string(value)
+	}
+	_, err := fmt.Fprint(w, "{"+strings.Join(parts, ",")+"}")
+	return err
+}
+
+func listText(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// yamlScalar quotes strings YAML would otherwise read as another type or
+// misparse.
+func yamlScalar(v any) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case int:
+		return strconv.Itoa(value)
+	case string:
+		plain := value != "" && strings.TrimSpace(value) == value &&
+			!strings.ContainsAny(value, ":#{}[],&*!|>'\"%@`") &&
+			!strings.ContainsAny(value[:1], "-?~")
+		switch strings.ToLower(value) {
+		case "null", "true", "false", "yes", "no", "on", "off":
+			plain = false
+		}
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			plain = false
+		}
+		if plain {
+			return value
+		}
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -19,8 +21,54 @@ import (
 	"github.com/rivo/tview"
 )
 
+// BlockKind distinguishes connectable Host blocks from Match rule blocks.
+type BlockKind int
+
+const (
+	BlockHost BlockKind = iota
+	BlockMatch
+	// BlockGlobal holds directives written before the first Host or Match
+	// line of a file; they apply to every connection.
+	BlockGlobal
+)
+
+// ConfigOption is a single directive as written in a config file.
+type ConfigOption struct {
+	Key        string
+	Value      string
+	SourcePath string
+	Line       int
+	// Seq is the place of the directive in the order ssh reads them,
+	// across all included files.
+	Seq int
+}
+
+// MatchCriterion is one "keyword [argument]" pair of a Match line, e.g.
+// "host *.corp" or "!exec \"test -f x\"". Value is empty for all/canonical/final.
+type MatchCriterion struct {
+	Keyword string
+	Negated bool
+	Value   string
+}
+
+func (c MatchCriterion) String() string {
+	keyword := c.Keyword
+	if c.Negated {
+		keyword = "!" + keyword
+	}
+	if c.Value == "" {
+		return keyword
+	}
+	if strings.ContainsAny(c.Value, " \t") {
+		return fmt.Sprintf("%s \"%s\"", keyword, c.Value)
+	}
+	return keyword + " " + c.Value
+}
+
 type HostEntry struct {
+	Kind                BlockKind
 	Patterns            []string
+	Criteria            []MatchCriterion
 	HostName            string
 	User                string
 	Port                string
@@ -30,12 +78,36 @@ type HostEntry struct {
 	ServerAliveCountMax *int
 	ForwardAgent        *bool
 	IdentitiesOnly      *bool
+	Options             []ConfigOption
 	SourcePath          string
+	StartLine           int
+	EndLine             int
+	Meta                HostMeta
+	// Seq is the reading order of the block's Host or Match line.
+	Seq int
+	// Within is the Host or Match block whose Include read this block's
+	// file. ssh applies the block only when that one matches too.
+	Within *HostEntry
+}
+
+// IsMatch reports whether the entry is a Match rule block rather than a host.
+func (entry HostEntry) IsMatch() bool {
+	return entry.Kind == BlockMatch
+}
+
+// CriteriaText renders the Match criteria the way they appear in the config.
+func (entry HostEntry) CriteriaText() string {
+	parts := make([]string, 0, len(entry.Criteria))
+	for _, c := range entry.Criteria {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " ")
 }
 
 func (entry HostEntry) SearchText() string {
 	parts := []string{
 		strings.Join(entry.Patterns, " "),
+		entry.CriteriaText(),
 		entry.HostName,
 		entry.User,
 		entry.Port,
@@ -54,10 +126,70 @@ func (entry HostEntry) SearchText() string {
 	if entry.IdentitiesOnly != nil {
 		parts = append(parts, fmt.Sprintf("%t", *entry.IdentitiesOnly))
 	}
+	for _, opt := range entry.ExtraOptions() {
+		parts = append(parts, opt.Key, opt.Value)
+	}
+	parts = append(parts, entry.Meta.Tags...)
+	parts = append(parts, entry.Meta.Owner, entry.Meta.Note)
 	return strings.ToLower(strings.Join(parts, " "))
 }
 
+// typedOptionKeys are the keywords that also have a field on HostEntry.
+var typedOptionKeys = map[string]bool{
+	"hostname":            true,
+	"user":                true,
+	"port":                true,
+	"identityfile":        true,
+	"proxyjump":           true,
+	"serveraliveinterval": true,
+	"serveralivecountmax": true,
+	"forwardagent":        true,
+	"identitiesonly":      true,
+}
+
+// Option returns the first value of key in this block, which is the one ssh
+// uses when the key appears more than once.
+func (entry HostEntry) Option(key string) (string, bool) {
+	for _, opt := range entry.Options {
+		if strings.EqualFold(opt.Key, key) {
+			return opt.Value, true
+		}
+	}
+	return "", false
+}
+
+// OptionValues returns every value of key in this block, in file order.
+func (entry HostEntry) OptionValues(key string) []string {
+	values := []string{}
+	for _, opt := range entry.Options {
+		if strings.EqualFold(opt.Key, key) {
+			values = append(values, opt.Value)
+		}
+	}
+	return values
+}
+
+// ExtraOptions returns the directives not already covered by the typed
+// fields: untyped keywords plus repeated occurrences of typed ones.
+func (entry HostEntry) ExtraOptions() []ConfigOption {
+	extras := []ConfigOption{}
+	seen := map[string]bool{}
+	for _, opt := range entry.Options {
+		key := strings.ToLower(opt.Key)
+		if typedOptionKeys[key] && !seen[key] {
+			seen[key] = true
+			continue
+		}
+		extras = append(extras, opt)
+	}
+	return extras
+}
+
 func (entry HostEntry) DisplayText() (string, string) {
+	if entry.IsMatch() {
+		return "Match " + entry.CriteriaText(), ""
+	}
+
 	mainText := "(unnamed)"
 	if len(entry.Patterns) > 0 {
 		mainText = entry.Patterns[0]
@@ -79,6 +211,7 @@ func (entry HostEntry) DisplayText() (string, string) {
 
 // accessKey builds a stable key for LastAccess lookup/storage.
 // It includes: alias (Patterns[0]), HostName, User, Port — empty strings when missing.
+// Edits that change any of these move the record with moveAccessRecord.
 func accessKey(entry HostEntry) string {
 	alias := ""
 	if len(entry.Patterns) > 0 {
@@ -89,8 +222,23 @@ func accessKey(entry HostEntry) string {
 
 type AppConfig struct {
 	ThemeName string `json:"theme_name"`
+	// ConnectMode selects what Enter does: connectModeExec or connectModeReturn.
+	ConnectMode string `json:"connect_mode"`
+	// GroupBy is the host list grouping: "", "file", "domain" or "prefix".
+	GroupBy string `json:"group_by"`
+	// Sort is the host list order: "config", "alpha", "recent", "frecency"
+	// or "check".
+	Sort string `json:"sort"`
+	// AddFile is where new hosts go instead of the main config, usually a
+	// file of an Include directory.
+	AddFile string `json:"add_file"`
 }
 
+const (
+	connectModeExec   = "exec"
+	connectModeReturn = "return"
+)
+
 type AppState struct {
 	App            *tview.Application
 	Pages          *tview.Pages
@@ -103,25 +251,40 @@ type AppState struct {
 	HostList       *tview.List
 	DetailTable    *tview.Table
 	ConfigPath     string
+	Blocks         []HostEntry
 	Entries        []HostEntry
 	Filtered       []HostEntry
 	CurrentIndex   int
+	Rows           []listRow
+	Collapsed      map[string]bool
 	ThemeIndex     int
 	ThemeCatalog   []AppTheme
 	CurrentFilter  string
+	Query          *hostQuery
 	LastUpdated    time.Time
 	LastLoadErr    error
 	ThemeModalOpen bool
-	LastAccess     map[string]string
+	LastAccess     map[string]AccessRecord
+	Config         AppConfig
+	Checks         map[string]CheckResult
+	Pins           map[string]bool
+	Latency        map[string][]LatencySample
+	CheckCancel    context.CancelFunc
 }
 
 var appVersion = "dev"
 
+// Key bindings listed by the help modal and the man page.
+var (
+	helpNavigationKeys = [][2]string{{"↑/↓", "move"}, {"←/→", "fold group"}, {":", "search focus"}, {"Esc", "close"}}
+	helpActionKeys     = [][2]string{{"Enter", "connect"}, {"s", "ssh & return"}, {"p", "ping"}, {"P", "ping all"}, {"o", "last check"}, {"a", "add"}, {"e", "edit"}, {"c", "clone"}, {"E", "$EDITOR"}, {"m", "move to file"}, {"M", "copy to file"}, {"d", "delete"}, {"u", "undo"}, {"Ctrl-r", "redo"}, {"f", "pin"}, {"S", "sort"}, {"g", "group by"}, {"z", "fold all"}, {"t", "theme"}, {"q", "quit"}, {"?", "help"}}
+)
+
 const githubURL = "https://github.com/dev-minsoo/55h"
 
 func versionLabel() string {
 	v := strings.TrimSpace(appVersion)
-	if v == "" {
+	if v == "" || v == "dev" {
 		return "dev"
 	}
 	if strings.HasPrefix(v, "v") {
@@ -133,15 +296,19 @@ func versionLabel() string {
 func main() {
 	configPath := resolveConfigPath()
 
-	// CLI: support "55h add ssh ..." before launching TUI
-	if len(os.Args) >= 3 && os.Args[1] == "add" && os.Args[2] == "ssh" {
-		if err := handleAddSSH(os.Args[3:], configPath); err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
-		}
-		return
+	// Subcommands run instead of the TUI.
+	if code, ok := runCLI(os.Args[1:], configPath); ok {
+		os.Exit(code)
+	}
+	if err := runTUI(configPath, ""); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
 	}
+}
 
+// runTUI opens the host browser, with the search box pre-filled when
+// query is not empty.
+func runTUI(configPath string, query string) error {
 	app := tview.NewApplication()
 	pages := tview.NewPages()
 	root := tview.NewFlex().SetDirection(tview.FlexRow)
@@ -177,6 +344,9 @@ func main() {
 	// Load saved theme
 	state.loadAppConfig()
 	state.loadAccessLog()
+	state.loadChecks()
+	state.loadLatency()
+	state.Pins = loadPins()
 
 	setupHeader(header, headerLogo, headerMeta)
 	setupFooter(footer)
@@ -199,6 +369,10 @@ func main() {
 
 	state.applyTheme(state.ThemeCatalog[state.ThemeIndex])
 	state.reload()
+	if query != "" {
+		// SetText runs the changed func, which filters the list
+		searchInput.SetText(query)
+	}
 
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		// If theme modal is open, don't process global shortcuts
@@ -215,9 +389,22 @@ func main() {
 			return nil
 		case tcell.KeyEnter:
 			if !searchFocused {
+				if group, ok := state.selectedGroup(); ok {
+					state.setGroupCollapsed(group, !state.Collapsed[group])
+					return nil
+				}
 				state.connectSSH()
 				return nil
 			}
+		case tcell.KeyLeft, tcell.KeyRight:
+			if !searchFocused && state.handleTreeKey(event.Key() == tcell.KeyRight) {
+				return nil
+			}
+		case tcell.KeyCtrlR:
+			if !searchFocused {
+				state.showUndoModal(true)
+				return nil
+			}
 		}
 
 		// Skip rune-based commands when search input is focused
@@ -241,18 +428,68 @@ func main() {
 		case 'd':
 			state.showDeleteConfirmModal()
 			return nil
+		case 'a':
+			state.showHostEditor(nil, nil)
+			return nil
+		case 'e':
+			if entry, ok := state.selectedEntry(); ok {
+				state.showHostEditor(&entry, nil)
+			}
+			return nil
+		case 'c':
+			if entry, ok := state.selectedEntry(); ok && entry.Kind != BlockGlobal && entry.SourcePath != "" {
+				state.showHostEditor(nil, &entry)
+			}
+			return nil
+		case 'E':
+			state.openInEditor()
+			return nil
 		case 'p':
 			state.testSSHConnection()
 			return nil
+		case 'P':
+			state.checkAllVisible()
+			return nil
+		case 'o':
+			if entry, ok := state.selectedEntry(); ok && !entry.IsMatch() && len(entry.Patterns) > 0 {
+				state.showCheckResultModal(entry.Patterns[0])
+			}
+			return nil
+		case 's':
+			state.connectAndReturn()
+			return nil
+		case 'g':
+			state.cycleGrouping()
+			return nil
+		case 'z':
+			state.toggleAllGroups()
+			return nil
+		case 'S':
+			state.cycleSort()
+			return nil
+		case 'f':
+			state.togglePin()
+			return nil
+		case 'u':
+			state.showUndoModal(false)
+			return nil
+		case 'm':
+			state.showMoveModal(false)
+			return nil
+		case 'M':
+			state.showMoveModal(true)
+			return nil
+		case ' ':
+			if group, ok := state.selectedGroup(); ok {
+				state.setGroupCollapsed(group, !state.Collapsed[group])
+			}
+			return nil
 		}
 
 		return event
 	})
 
-	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
-	}
+	return app.SetRoot(pages, true).EnableMouse(true).Run()
 }
 
 func resolveConfigPath() string {
@@ -287,6 +524,7 @@ func setupFooter(footer *tview.TextView) {
 	footer.SetDynamicColors(true)
 	footer.SetTextAlign(tview.AlignCenter)
 	footer.SetBorder(true)
+	footer.SetTitleAlign(tview.AlignLeft)
 }
 
 func setupSearchInput(input *tview.InputField, state *AppState) {
@@ -319,8 +557,9 @@ func setupDetailTable(detailTable *tview.Table) {
 }
 
 func (state *AppState) reload() {
-	entries, err := loadSSHConfig(state.ConfigPath)
-	state.Entries = entries
+	blocks, err := loadSSHConfigBlocks(state.ConfigPath)
+	state.Blocks = blocks
+	state.Entries = withoutGlobalBlocks(blocks)
 	state.LastUpdated = time.Now()
 	state.LastLoadErr = err
 	state.applyFilter(state.CurrentFilter)
@@ -328,6 +567,15 @@ func (state *AppState) reload() {
 }
 
 func (state *AppState) applyFilter(query string) {
+	// A query that does not parse (often one still being typed) keeps the
+	// last good one and shows why in the search box title.
+	if parsed, err := parseHostQuery(query); err != nil {
+		state.SearchInput.SetTitle(fmt.Sprintf(" Search [%s]%s[-] ", state.currentTheme().MarkupError, tview.Escape(err.Error())))
+	} else {
+		state.SearchInput.SetTitle(" Search ")
+		state.Query = parsed
+	}
+
 	state.Filtered = nil
 	state.CurrentIndex = 0
 	state.HostList.Clear()
@@ -349,9 +597,6 @@ func (state *AppState) applyFilter(query string) {
 	includedEntries := []HostEntry{}
 
 	for _, entry := range state.Entries {
-		if !fuzzyMatch(query, entry.SearchText()) {
-			continue
-		}
 		if isIncluded(entry) {
 			includedEntries = append(includedEntries, entry)
 		} else {
@@ -362,24 +607,44 @@ func (state *AppState) applyFilter(query string) {
 	if len(includedEntries) > 0 {
 		state.Filtered = append(state.Filtered, includedEntries...)
 	}
-	for _, entry := range state.Filtered {
-		mainText, secondary := entry.DisplayText()
-		state.HostList.AddItem(mainText, secondary, 0, nil)
+	state.Filtered = state.rankEntries(state.Filtered, state.Query)
+	state.fillHostList(0)
+}
+
+// fillHostList rebuilds the list rows from Filtered and selects the entry
+// at selected, or the first row when it is -1 or hidden.
+func (state *AppState) fillHostList(selected int) {
+	state.buildRows()
+	state.HostList.Clear()
+	state.HostList.SetTitle(state.hostListTitle())
+	state.CurrentIndex = -1
+	if len(state.Rows) > 0 {
+		state.CurrentIndex = state.Rows[0].Entry
+	}
+	for _, r := range state.Rows {
+		if r.IsGroup() {
+			state.HostList.AddItem(state.groupRowText(r.Group), "", 0, nil)
+			continue
+		}
+		_, secondary := state.Filtered[r.Entry].DisplayText()
+		state.HostList.AddItem(state.listItemText(r.Entry), secondary, 0, nil)
 	}
 
-	state.HostList.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
-		state.CurrentIndex = index
-		state.renderDetails(index)
+	state.HostList.SetSelectedFunc(func(row int, mainText string, secondaryText string, shortcut rune) {
+		state.selectRow(row)
 		state.updateHeaderMeta(state.LastUpdated, state.LastLoadErr)
 	})
-	state.HostList.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
-		state.CurrentIndex = index
-		state.renderDetails(index)
+	state.HostList.SetChangedFunc(func(row int, mainText string, secondaryText string, shortcut rune) {
+		previous := state.CurrentIndex
+		state.showRow(row)
+		state.refreshListItem(previous)
 		state.updateHeaderMeta(state.LastUpdated, state.LastLoadErr)
 	})
 
-	if len(state.Filtered) > 0 {
-		state.renderDetails(0)
+	if row := state.rowOf(selected); selected >= 0 && row >= 0 {
+		state.selectRow(row)
+	} else if len(state.Rows) > 0 {
+		state.selectRow(0)
 	} else {
 		state.DetailTable.Clear()
 		state.DetailTable.SetTitle(" Details ")
@@ -388,6 +653,82 @@ func (state *AppState) applyFilter(query string) {
 	state.updateHeaderMeta(state.LastUpdated, state.LastLoadErr)
 }
 
+// selectRow moves the cursor to a list row and shows it.
+func (state *AppState) selectRow(row int) {
+	if row < 0 || row >= len(state.Rows) {
+		return
+	}
+	if state.HostList.GetCurrentItem() != row {
+		// SetCurrentItem runs the changed func, which shows the row
+		state.HostList.SetCurrentItem(row)
+		return
+	}
+	state.showRow(row)
+}
+
+// showRow shows the details of a list row: the host, or a summary of the
+// group for a header.
+func (state *AppState) showRow(row int) {
+	if row < 0 || row >= len(state.Rows) {
+		return
+	}
+	r := state.Rows[row]
+	state.CurrentIndex = r.Entry
+	if r.IsGroup() {
+		state.renderGroupDetails(r.Group)
+		return
+	}
+	state.refreshListItem(r.Entry)
+	state.renderDetails(r.Entry)
+}
+
+// selectEntry moves the list selection to the host with the given alias in
+// path, typically after the file was rewritten and reloaded.
+func (state *AppState) selectEntry(path string, alias string) bool {
+	for i, entry := range state.Filtered {
+		if entry.SourcePath == path && len(entry.Patterns) > 0 && entry.Patterns[0] == alias {
+			state.selectIndex(i)
+			return true
+		}
+	}
+	return false
+}
+
+// selectEntryAt selects the entry of path that starts closest to line, for
+// blocks without a usable alias or whose alias was changed.
+func (state *AppState) selectEntryAt(path string, line int) {
+	best, bestDist := -1, 0
+	for i, entry := range state.Filtered {
+		if entry.SourcePath != path {
+			continue
+		}
+		dist := entry.StartLine - line
+		if dist < 0 {
+			dist = -dist
+		}
+		if best == -1 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	if best >= 0 {
+		state.selectIndex(best)
+	}
+}
+
+func (state *AppState) selectIndex(i int) {
+	row := state.rowOf(i)
+	if row < 0 {
+		// The entry is in a collapsed group; open it
+		if i < 0 || i >= len(state.Filtered) {
+			return
+		}
+		delete(state.Collapsed, state.groupKey(state.Filtered[i]))
+		state.fillHostList(i)
+		return
+	}
+	state.selectRow(row)
+}
+
 func (state *AppState) updateHeaderMeta(updatedAt time.Time, loadErr error) {
 	themeName := state.ThemeCatalog[state.ThemeIndex].Name
 	updatedAtText := updatedAt.Format("15:04:05")
@@ -414,7 +755,11 @@ func (state *AppState) renderDetails(index int) {
 
 	entry := state.Filtered[index]
 	state.DetailTable.Clear()
-	state.DetailTable.SetTitle(fmt.Sprintf(" Details: %s ", strings.Join(entry.Patterns, ", ")))
+	if entry.IsMatch() {
+		state.DetailTable.SetTitle(" Details: Match rule ")
+	} else {
+		state.DetailTable.SetTitle(fmt.Sprintf(" Details: %s ", strings.Join(entry.Patterns, ", ")))
+	}
 
 	// Always show all supported detail keys. Use empty string for missing values.
 	srvAliveInterval := ""
@@ -449,10 +794,13 @@ func (state *AppState) renderDetails(index int) {
 		}
 	}
 	lastAccess := ""
+	lastSessionEnd := ""
 	// Lookup last access using a composite key to avoid collisions between aliases
 	key := accessKey(entry)
-	if ts, ok := state.LastAccess[key]; ok {
-		lastAccess = ts
+	record, hasRecord := state.LastAccess[key]
+	if hasRecord {
+		lastAccess = record.LastAccess
+		lastSessionEnd = record.LastSessionEnd
 	}
 	rows := [][2]string{
 		{"HostName", entry.HostName},
@@ -464,11 +812,57 @@ func (state *AppState) renderDetails(index int) {
 		{"ServerAliveCountMax", srvAliveCountMax},
 		{"ForwardAgent", forwardAgent},
 		{"IdentitiesOnly", identitiesOnly},
-		{"LastLoginAt", lastAccess},
+	}
+	// Every other directive follows in file order, including repeated keys
+	// such as a second IdentityFile or several LocalForward lines.
+	for _, opt := range entry.ExtraOptions() {
+		rows = append(rows, [2]string{opt.Key, tview.Escape(opt.Value)})
+	}
+	for _, row := range metaRows(entry.Meta) {
+		rows = append(rows, [2]string{row[0], tview.Escape(row[1])})
+	}
+	if entry.IsMatch() {
+		// Match blocks are rules applied to other hosts; there is no login to show.
+		rows = append([][2]string{{"Match", entry.CriteriaText()}}, rows...)
+	} else {
+		rows = append(rows, [2]string{"LastLoginAt", lastAccess})
+		if lastSessionEnd != "" {
+			rows = append(rows, [2]string{"LastSessionEnd", lastSessionEnd})
+		}
+		if hasRecord && record.Count > 0 {
+			connections := fmt.Sprintf("%d", record.Count)
+			if record.FirstAccess != "" {
+				connections += " since " + record.FirstAccess
+			}
+			rows = append(rows, [2]string{"Connections", connections})
+		}
+		if record.SessionSeconds > 0 {
+			rows = append(rows, [2]string{"SessionTime", formatSessionTime(record.SessionSeconds)})
+		}
+		if state.isPinned(entry) {
+			rows = append(rows, [2]string{"Pinned", "yes"})
+		}
+		if len(entry.Patterns) > 0 {
+			if result, ok := state.Checks[entry.Patterns[0]]; ok && result.Status != CheckRunning {
+				rows = append(rows, [2]string{"LastCheck", state.checkSummary(result)})
+				if len(result.AuthMethods) > 0 {
+					rows = append(rows, [2]string{"AuthMethods", tview.Escape(strings.Join(result.AuthMethods, ", "))})
+				}
+				if len(result.Hops) > 1 {
+					rows = append(rows, [2]string{"Hops", hopsText(result.Hops, state.currentTheme().MarkupWarning)})
+				}
+			}
+			if latency := state.latencySummary(entry.Patterns[0]); latency != "" {
+				rows = append(rows, [2]string{"Latency", latency})
+			}
+		}
 	}
 	if includedFrom != "" {
 		rows = append(rows, [2]string{"IncludedFrom", includedFrom})
 	}
+	if entry.StartLine > 0 {
+		rows = append(rows, [2]string{"Lines", fmt.Sprintf("%d-%d", entry.StartLine, entry.EndLine)})
+	}
 
 	for i, row := range rows {
 		labelCell := tview.NewTableCell("[::b]" + row[0])
@@ -479,6 +873,63 @@ func (state *AppState) renderDetails(index int) {
 		state.DetailTable.SetCell(i, 0, labelCell)
 		state.DetailTable.SetCell(i, 1, valueCell)
 	}
+
+	if entry.IsMatch() || len(entry.Patterns) == 0 || strings.ContainsAny(entry.Patterns[0], "*?!") {
+		return
+	}
+	row := state.renderJumpChain(len(rows)+1, resolveJumpChain(state.Blocks, entry.Patterns[0]))
+	state.renderEffectiveConfig(row, resolveEffectiveConfig(state.Blocks, entry.Patterns[0]))
+}
+
+// renderEffectiveConfig appends the resolved options below the block's own
+// rows, with the file and line each value came from.
+func (state *AppState) renderEffectiveConfig(row int, cfg EffectiveConfig) {
+	theme := state.currentTheme()
+	header := tview.NewTableCell(fmt.Sprintf("[::b][%s]Effective (ssh %s)[-:-:-]", theme.MarkupAccent, cfg.Alias))
+	header.SetSelectable(false)
+	state.DetailTable.SetCell(row, 0, header)
+	row++
+
+	for _, opt := range cfg.Options {
+		labelCell := tview.NewTableCell("[::b]" + opt.Key)
+		valueCell := tview.NewTableCell(tview.Escape(opt.Value))
+		sourceCell := tview.NewTableCell(tview.Escape(state.sourceLabel(opt.SourcePath, opt.Line)))
+		labelCell.SetTextColor(theme.Label)
+		valueCell.SetTextColor(theme.Text)
+		valueCell.SetExpansion(1)
+		sourceCell.SetTextColor(theme.Muted)
+		state.DetailTable.SetCell(row, 0, labelCell)
+		state.DetailTable.SetCell(row, 1, valueCell)
+		state.DetailTable.SetCell(row, 2, sourceCell)
+		row++
+	}
+	for _, note := range cfg.Notes {
+		noteCell := tview.NewTableCell(tview.Escape(note))
+		noteCell.SetTextColor(theme.Muted)
+		state.DetailTable.SetCell(row, 1, noteCell)
+		row++
+	}
+}
+
+// sourceLabel formats "file:line" relative to the main config directory.
+func (state *AppState) sourceLabel(path string, line int) string {
+	label := path
+	base := state.ConfigPath
+	if abs, err := filepath.Abs(base); err == nil {
+		base = abs
+	}
+	if rel, err := filepath.Rel(filepath.Dir(base), path); err == nil && !strings.HasPrefix(rel, "..") {
+		label = rel
+	}
+	return fmt.Sprintf("%s:%d", label, line)
+}
+
+// selectedEntry returns the entry under the list cursor.
+func (state *AppState) selectedEntry() (HostEntry, bool) {
+	if state.CurrentIndex < 0 || state.CurrentIndex >= len(state.Filtered) {
+		return HostEntry{}, false
+	}
+	return state.Filtered[state.CurrentIndex], true
 }
 
 func (state *AppState) showThemeModal() {
@@ -677,8 +1128,8 @@ func (state *AppState) showHelpModal() {
 	rightTable.SetBackgroundColor(theme.PanelBg)
 
 	// Content rows (unchanged texts)
-	navRows := [][2]string{{"↑/↓", "move"}, {":", "search focus"}, {"Esc", "close"}}
-	actRows := [][2]string{{"Enter", "connect"}, {"p", "ping"}, {"d", "delete"}, {"t", "theme"}, {"q", "quit"}, {"?", "help"}}
+	navRows := helpNavigationKeys
+	actRows := helpActionKeys
 
 	// Add small header TextViews above each table (Navigation / Actions)
 	navHeaderTV := tview.NewTextView()
@@ -797,7 +1248,8 @@ func (state *AppState) showHelpModal() {
 	})
 
 	// Center modal on screen
-	modalHeight := 6 + maxRows
+	// border, header, divider, padding, divider and footer take 7 rows
+	modalHeight := 7 + maxRows
 	modalFlex := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(nil, 0, 1, false).
 		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
@@ -810,23 +1262,66 @@ func (state *AppState) showHelpModal() {
 	state.App.SetFocus(modalBox)
 }
 
+// deleteChoice is one button of the delete confirmation. Pattern is the
+// single pattern to drop, or empty to remove the whole block.
+type deleteChoice struct {
+	Label   string
+	Key     rune
+	Pattern string
+	Preview string
+	Cancel  bool
+}
+
 func (state *AppState) showDeleteConfirmModal() {
 	if state.CurrentIndex < 0 || state.CurrentIndex >= len(state.Filtered) {
 		return
 	}
 
 	entry := state.Filtered[state.CurrentIndex]
-	if len(entry.Patterns) == 0 {
+	if len(entry.Patterns) == 0 && !entry.IsMatch() {
 		return
 	}
 
+	theme := state.currentTheme()
+	hostName := ""
+	if entry.IsMatch() {
+		hostName = "Match " + entry.CriteriaText()
+	} else {
+		hostName = entry.Patterns[0]
+	}
+
+	// A Host line with several patterns offers to drop any one of them,
+	// picked with its number; otherwise the whole block goes.
+	choices := []deleteChoice{{Label: "Yes", Key: 'y'}}
+	if !entry.IsMatch() && len(entry.Patterns) > 1 {
+		choices = nil
+		for i, p := range entry.Patterns {
+			choice := deleteChoice{Label: "Only " + p, Pattern: p}
+			if i < 9 {
+				choice.Key = rune('1' + i)
+				choice.Label = fmt.Sprintf("%d: Only %s", i+1, p)
+			}
+			choices = append(choices, choice)
+		}
+		choices = append(choices, deleteChoice{Label: "Whole block", Key: 'b'})
+		hostName = strings.Join(entry.Patterns, " ")
+	}
+	for i := range choices {
+		preview, err := previewHostRemoval(entry, choices[i].Pattern)
+		if err != nil {
+			state.showMessageModal("Error", tview.Escape(err.Error()))
+			return
+		}
+		choices[i].Preview = preview
+	}
+	choices = append(choices, deleteChoice{Label: "No", Key: 'n', Cancel: true})
+	if len(choices) > 2 {
+		choices[len(choices)-1].Label = "Cancel"
+	}
+
 	state.ThemeModalOpen = true
 	state.App.EnableMouse(false)
 
-	theme := state.currentTheme()
-	hostName := entry.Patterns[0]
-
-	// Create confirmation modal
 	modalBox := tview.NewFlex().SetDirection(tview.FlexRow)
 	modalBox.SetBorder(true)
 	modalBox.SetTitle(" Delete Host ")
@@ -840,7 +1335,17 @@ func (state *AppState) showDeleteConfirmModal() {
 	msgText.SetDynamicColors(true)
 	msgText.SetTextAlign(tview.AlignCenter)
 	msgText.SetBackgroundColor(theme.PanelBg)
-	msgText.SetText(fmt.Sprintf("Delete [%s]%s[-:-:-] from SSH config?", theme.MarkupAccent, hostName))
+	msgText.SetTextColor(theme.Text)
+	location := fmt.Sprintf("%s:%d", state.relativeSourcePath(entry.SourcePath), entry.StartLine)
+	msgText.SetText(fmt.Sprintf("Delete [%s]%s[-:-:-] from %s?", theme.MarkupAccent, tview.Escape(hostName), tview.Escape(location)))
+
+	// The diff of the focused choice
+	previewText := tview.NewTextView()
+	previewText.SetDynamicColors(true)
+	previewText.SetWrap(false)
+	previewText.SetBackgroundColor(theme.PanelBg)
+	previewText.SetTextColor(theme.Text)
+	previewText.SetBorderPadding(0, 0, 2, 2)
 
 	closeModal := func() {
 		state.App.EnableMouse(true)
@@ -849,10 +1354,16 @@ func (state *AppState) showDeleteConfirmModal() {
 		state.App.SetFocus(state.HostList)
 	}
 
-	doDelete := func() {
+	doDelete := func(choice deleteChoice) {
 		closeModal()
-		if err := state.deleteHostEntry(entry); err != nil {
+		if choice.Cancel {
+			return
+		}
+		if err := state.deleteHostEntry(entry, choice.Pattern); err != nil {
 			state.showMessageModal("Error", err.Error())
+		} else if choice.Pattern != "" {
+			state.showMessageModal("Deleted", fmt.Sprintf("Pattern '%s' has been removed from its Host line.", choice.Pattern))
+			state.reload()
 		} else {
 			state.showMessageModal("Deleted", fmt.Sprintf("Host '%s' has been deleted.", hostName))
 			state.reload()
@@ -868,53 +1379,86 @@ func (state *AppState) showDeleteConfirmModal() {
 		return tview.NewBox().SetBackgroundColor(theme.PanelBg)
 	}
 
-	yesBtn := tview.NewTextView()
-	yesBtn.SetTextAlign(tview.AlignCenter)
-	yesBtn.SetText("Yes")
-
-	noBtn := tview.NewTextView()
-	noBtn.SetTextAlign(tview.AlignCenter)
-	noBtn.SetText("No")
+	// The buttons sit in a row, or one per line when a long Host line
+	// gives more than fit across the modal.
+	modalWidth := 76
+	rowWidth, columnWidth := -2, 0
+	for _, choice := range choices {
+		rowWidth += max(10, len(choice.Label)+4) + 2
+		columnWidth = max(columnWidth, len(choice.Label)+4)
+	}
+	buttonRows := 1
+	if rowWidth > modalWidth-4 {
+		buttonRows = len(choices)
+		btnFlex.SetDirection(tview.FlexRow)
+	}
+
+	buttons := make([]*tview.TextView, len(choices))
+	if buttonRows == 1 {
+		btnFlex.AddItem(bgBox(), 0, 1, false)
+	}
+	for i, choice := range choices {
+		buttons[i] = tview.NewTextView()
+		buttons[i].SetTextAlign(tview.AlignCenter)
+		buttons[i].SetText(choice.Label)
+		if buttonRows > 1 {
+			line := tview.NewFlex().SetDirection(tview.FlexColumn).
+				AddItem(bgBox(), 0, 1, false).
+				AddItem(buttons[i], columnWidth, 0, false).
+				AddItem(bgBox(), 0, 1, false)
+			btnFlex.AddItem(line, 1, 0, false)
+			continue
+		}
+		if i > 0 {
+			btnFlex.AddItem(bgBox(), 2, 0, false)
+		}
+		btnFlex.AddItem(buttons[i], max(10, len(choice.Label)+4), 0, false)
+	}
+	if buttonRows == 1 {
+		btnFlex.AddItem(bgBox(), 0, 1, false)
+	}
 
-	// Focus handling between buttons
-	focusYes := true
+	// Focus handling between buttons; the preview follows the focus.
+	focused := 0
 	updateBtnStyle := func() {
-		if focusYes {
-			yesBtn.SetBackgroundColor(theme.Accent)
-			yesBtn.SetTextColor(theme.Bg)
-			noBtn.SetBackgroundColor(theme.PanelBg)
-			noBtn.SetTextColor(theme.Text)
-		} else {
-			yesBtn.SetBackgroundColor(theme.PanelBg)
-			yesBtn.SetTextColor(theme.Text)
-			noBtn.SetBackgroundColor(theme.Accent)
-			noBtn.SetTextColor(theme.Bg)
+		for i, btn := range buttons {
+			if i == focused {
+				btn.SetBackgroundColor(theme.Accent)
+				btn.SetTextColor(theme.Bg)
+			} else {
+				btn.SetBackgroundColor(theme.PanelBg)
+				btn.SetTextColor(theme.Text)
+			}
+		}
+		if !choices[focused].Cancel {
+			previewText.SetText(strings.Join(diffMarkup(choices[focused].Preview, theme), "\n"))
+			previewText.ScrollToBeginning()
 		}
 	}
 	updateBtnStyle()
 
-	btnFlex.AddItem(bgBox(), 0, 1, false)
-	btnFlex.AddItem(yesBtn, 10, 0, false)
-	btnFlex.AddItem(bgBox(), 2, 0, false)
-	btnFlex.AddItem(noBtn, 10, 0, false)
-	btnFlex.AddItem(bgBox(), 0, 1, false)
-
-	// Small padding rows: add one above and one below message so the message
-	// sits in the middle row (two extra rows of vertical padding compared to before)
+	// Padding rows around the message and above the buttons
 	topPad := tview.NewTextView()
 	topPad.SetBackgroundColor(theme.PanelBg)
 	bottomPad := tview.NewTextView()
 	bottomPad.SetBackgroundColor(theme.PanelBg)
+	buttonPad := tview.NewTextView()
+	buttonPad.SetBackgroundColor(theme.PanelBg)
 
-	// Ensure message text color matches theme
-	msgText.SetTextColor(theme.Text)
+	// The preview gets as many rows as the longest diff needs, up to 16.
+	previewRows := 0
+	for _, choice := range choices {
+		previewRows = max(previewRows, len(diffMarkup(choice.Preview, theme)))
+	}
+	previewRows = min(previewRows, 16)
 
-	// Use fixed small heights to avoid excess vertical space and place message
-	// in the middle of the content area: [topPad][msgText][bottomPad][buttons]
+	// [topPad][msgText][bottomPad][preview][buttonPad][buttons]
 	modalBox.AddItem(topPad, 1, 0, false)
 	modalBox.AddItem(msgText, 1, 0, false)
 	modalBox.AddItem(bottomPad, 1, 0, false)
-	modalBox.AddItem(btnFlex, 1, 0, false)
+	modalBox.AddItem(previewText, previewRows, 0, false)
+	modalBox.AddItem(buttonPad, 1, 0, false)
+	modalBox.AddItem(btnFlex, buttonRows, 0, false)
 
 	modalBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
@@ -922,32 +1466,37 @@ func (state *AppState) showDeleteConfirmModal() {
 			closeModal()
 			return nil
 		case tcell.KeyEnter:
-			if focusYes {
-				doDelete()
-			} else {
-				closeModal()
-			}
+			doDelete(choices[focused])
 			return nil
-		case tcell.KeyTab, tcell.KeyLeft, tcell.KeyRight:
-			focusYes = !focusYes
+		case tcell.KeyTab, tcell.KeyRight:
+			focused = (focused + 1) % len(choices)
 			updateBtnStyle()
 			return nil
-		}
-		switch event.Rune() {
-		case 'y', 'Y':
-			doDelete()
+		case tcell.KeyBacktab, tcell.KeyLeft:
+			focused = (focused + len(choices) - 1) % len(choices)
+			updateBtnStyle()
 			return nil
-		case 'n', 'N':
-			closeModal()
+		case tcell.KeyUp, tcell.KeyDown:
+			row, col := previewText.GetScrollOffset()
+			if event.Key() == tcell.KeyUp && row > 0 {
+				row--
+			} else if event.Key() == tcell.KeyDown {
+				row++
+			}
+			previewText.ScrollTo(row, col)
 			return nil
 		}
+		for _, choice := range choices {
+			if event.Rune() == choice.Key || event.Rune() == unicode.ToUpper(choice.Key) {
+				doDelete(choice)
+				return nil
+			}
+		}
 		return event
 	})
 
-	modalWidth := 50
-	// modal inner rows: [topPad][msgText][bottomPad][buttons] = 4 rows.
-	// Given the modal border, set modalHeight so the outer height equals 6.
-	modalHeight := 6
+	// Rows above plus the modal border.
+	modalHeight := 4 + buttonRows + previewRows + 2
 
 	// Use transparent spacers for top, sides, and bottom — transparent
 	// spacers only (no opaque bottom spacer).
@@ -963,67 +1512,77 @@ func (state *AppState) showDeleteConfirmModal() {
 	state.App.SetFocus(modalBox)
 }
 
-func (state *AppState) deleteHostEntry(entry HostEntry) error {
+// previewHostRemoval returns the diff deleting entry (or just pattern from
+// its Host line) would make, without writing it.
+func previewHostRemoval(entry HostEntry, pattern string) (string, error) {
 	if entry.SourcePath == "" {
-		return fmt.Errorf("unknown source file for this entry")
+		return "", fmt.Errorf("unknown source file for this entry")
 	}
-
-	data, err := os.ReadFile(entry.SourcePath)
+	doc, err := parseConfigDocument(entry.SourcePath)
 	if err != nil {
-		return fmt.Errorf("failed to read config: %v", err)
+		return "", fmt.Errorf("failed to read config: %v", err)
 	}
-
-	lines := strings.Split(string(data), "\n")
-	var result []string
-	skip := false
-	hostPattern := ""
-	if len(entry.Patterns) > 0 {
-		hostPattern = entry.Patterns[0]
+	before := doc.Bytes()
+	if err := removeHostEntry(doc, entry, pattern); err != nil {
+		return "", err
 	}
+	return unifiedDiff(entry.SourcePath, before, doc.Bytes()), nil
+}
 
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		fields := strings.Fields(trimmed)
-
-		if len(fields) >= 2 && strings.ToLower(fields[0]) == "host" {
-			// Check if this is the host block we want to delete
-			isTarget := false
-			for _, p := range fields[1:] {
-				if p == hostPattern {
-					isTarget = true
-					break
-				}
-			}
-			if isTarget {
-				skip = true
-				continue
-			} else {
-				skip = false
-			}
-		}
-
-		if !skip {
-			result = append(result, line)
-		}
+// deleteHostEntry removes entry, or only pattern from its Host line when
+// pattern is not empty, and saves the file.
+func (state *AppState) deleteHostEntry(entry HostEntry, pattern string) error {
+	if entry.SourcePath == "" {
+		return fmt.Errorf("unknown source file for this entry")
 	}
 
-	// Remove trailing empty lines
-	for len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" {
-		result = result[:len(result)-1]
+	doc, err := parseConfigDocument(entry.SourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
 	}
-
-	output := strings.Join(result, "\n")
-	if !strings.HasSuffix(output, "\n") {
-		output += "\n"
+	if err := removeHostEntry(doc, entry, pattern); err != nil {
+		return err
 	}
-
-	if err := os.WriteFile(entry.SourcePath, []byte(output), 0644); err != nil {
+	reason := "delete " + firstPattern(entry)
+	if entry.IsMatch() {
+		reason = "delete Match " + entry.CriteriaText()
+	} else if pattern != "" {
+		reason = "delete pattern " + pattern
+	}
+	if err := doc.Save(reason); err != nil {
 		return fmt.Errorf("failed to write config: %v", err)
 	}
 
 	return nil
 }
 
+// removeHostEntry deletes the block of entry from its parsed source file,
+// or only pattern from its Host line when pattern is not empty. The block
+// is found by its line, and other blocks using the same names are left
+// alone. The TUI and 55h rm both go through here.
+func removeHostEntry(doc *ConfigDocument, entry HostEntry, pattern string) error {
+	block, err := findEntryBlock(doc, entry)
+	if err != nil {
+		return err
+	}
+	if pattern != "" && len(block.Patterns) > 1 {
+		return doc.RemovePattern(entry.StartLine, pattern)
+	}
+	return doc.RemoveBlock(entry.StartLine)
+}
+
+// findEntryBlock returns the block of entry in doc, checking it is still
+// the one that was loaded.
+func findEntryBlock(doc *ConfigDocument, entry HostEntry) (DocBlock, error) {
+	block, err := doc.FindBlock(entry.StartLine)
+	if err != nil || block.Kind != entry.Kind || strings.Join(block.Patterns, " ") != strings.Join(entry.Patterns, " ") {
+		// The file changed since it was loaded; don't guess which block
+		// was meant.
+		return DocBlock{}, fmt.Errorf("%s changed since it was loaded: the block is no longer at line %d", entry.SourcePath, entry.StartLine)
+	}
+	return block, nil
+}
+
 func (state *AppState) showMessageModal(title, message string) {
 	state.ThemeModalOpen = true
 	state.App.EnableMouse(false)
@@ -1082,12 +1641,8 @@ func (state *AppState) showMessageModal(title, message string) {
 }
 
 func (state *AppState) testSSHConnection() {
-	if state.CurrentIndex < 0 || state.CurrentIndex >= len(state.Filtered) {
-		return
-	}
-
-	entry := state.Filtered[state.CurrentIndex]
-	if len(entry.Patterns) == 0 {
+	entry, ok := state.connectableEntry("test")
+	if !ok {
 		return
 	}
 
@@ -1095,38 +1650,47 @@ func (state *AppState) testSSHConnection() {
 	state.showMessageModal("Testing", fmt.Sprintf("Testing SSH connection to %s...", host))
 
 	go func() {
-		// Use ssh with ConnectTimeout and BatchMode to test connection
-		cmd := exec.Command("ssh",
-			"-o", "ConnectTimeout=5",
-			"-o", "BatchMode=yes",
-			"-o", "StrictHostKeyChecking=accept-new",
-			host,
-			"exit", "0",
-		)
-
-		err := cmd.Run()
+		result := runSSHCheck(context.Background(), host)
 
 		state.App.QueueUpdateDraw(func() {
 			// Close the "Testing" modal first
 			state.Pages.RemovePage("message-modal")
 			state.ThemeModalOpen = false
-
-			if err != nil {
-				state.showMessageModal("Connection Failed", fmt.Sprintf("Failed to connect to %s\n\nError: %v", host, err))
-			} else {
-				state.showMessageModal("Connection Success", fmt.Sprintf("Successfully connected to %s", host))
-			}
+			state.setCheckResult(host, result)
+			appendLatency(state.Latency, host, result)
+			state.saveChecks()
+			state.saveLatency()
+			state.renderDetails(state.CurrentIndex)
+			state.showCheckResultModal(host)
 		})
 	}()
 }
 
+// connectableEntry returns the selected entry if it can be used as an ssh
+// target, explaining in a modal when it cannot.
+func (state *AppState) connectableEntry(action string) (HostEntry, bool) {
+	entry, ok := state.selectedEntry()
+	if !ok {
+		return HostEntry{}, false
+	}
+	if entry.IsMatch() {
+		state.showMessageModal("Match Rule", fmt.Sprintf("Match blocks are rules, not hosts.\nSelect a Host entry to %s.", action))
+		return HostEntry{}, false
+	}
+	if len(entry.Patterns) == 0 {
+		return HostEntry{}, false
+	}
+	return entry, true
+}
+
 func (state *AppState) connectSSH() {
-	if state.CurrentIndex < 0 || state.CurrentIndex >= len(state.Filtered) {
+	if state.Config.ConnectMode == connectModeReturn {
+		state.connectAndReturn()
 		return
 	}
 
-	entry := state.Filtered[state.CurrentIndex]
-	if len(entry.Patterns) == 0 {
+	entry, ok := state.connectableEntry("connect")
+	if !ok {
 		return
 	}
 
@@ -1138,21 +1702,70 @@ func (state *AppState) connectSSH() {
 	// Stop the TUI application
 	state.App.Stop()
 
-	// Find ssh binary path
+	if err := execSSH(host, nil); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// execSSH replaces the current process with ssh so it gets full control,
+// including TTY handling. It only returns on failure.
+func execSSH(host string, remoteCommand []string) error {
 	sshPath, err := exec.LookPath("ssh")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "ssh not found: %v\n", err)
-		os.Exit(1)
+		return fmt.Errorf("ssh not found: %v", err)
 	}
+	argv := append([]string{"ssh", host}, remoteCommand...)
+	if err := syscall.Exec(sshPath, argv, os.Environ()); err != nil {
+		return fmt.Errorf("failed to exec ssh: %v", err)
+	}
+	return nil
+}
 
-	// Replace current process with ssh using syscall.Exec
-	// This gives full control to ssh including TTY handling
-	if err := syscall.Exec(sshPath, []string{"ssh", host}, os.Environ()); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to exec ssh: %v\n", err)
-		os.Exit(1)
+// connectAndReturn runs ssh as a child process on the real terminal while the
+// TUI is suspended. Filter, selection and scroll position are untouched, so
+// the list comes back exactly as it was left.
+func (state *AppState) connectAndReturn() {
+	entry, ok := state.connectableEntry("connect")
+	if !ok {
+		return
+	}
+
+	host := entry.Patterns[0]
+	state.recordAccess(entry)
+
+	start := time.Now()
+	var runErr error
+	state.App.Suspend(func() {
+		cmd := exec.Command("ssh", host)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		runErr = cmd.Run()
+	})
+	end := time.Now()
+	state.recordSessionEnd(entry, start, end)
+	state.renderDetails(state.CurrentIndex)
+
+	theme := state.currentTheme()
+	duration := end.Sub(start).Round(time.Second)
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil:
+		state.setStatus(theme.MarkupSuccess, fmt.Sprintf("ssh %s exited 0 after %s", host, duration))
+	case errors.As(runErr, &exitErr):
+		state.setStatus(theme.MarkupError, fmt.Sprintf("ssh %s exited %d after %s", host, exitErr.ExitCode(), duration))
+	default:
+		state.setStatus(theme.MarkupError, fmt.Sprintf("ssh %s failed: %v", host, runErr))
 	}
 }
 
+// setStatus shows a one-line message in the footer border without
+// interrupting the user.
+func (state *AppState) setStatus(color string, text string) {
+	state.Footer.SetTitle(fmt.Sprintf(" [%s]%s[-] ", color, tview.Escape(text)))
+}
+
 func (state *AppState) applyTheme(theme AppTheme) {
 	tview.Styles = theme.TView
 	state.Root.SetBackgroundColor(theme.Bg)
@@ -1190,8 +1803,8 @@ func (state *AppState) applyTheme(theme AppTheme) {
 func (state *AppState) updateFooter() {
 	// Use a single consistent markup color for all shortcut tokens
 	accent := state.currentTheme().MarkupAccent
-	footer := fmt.Sprintf("[::b][%s]q[-:-:-] quit  [%s]:[-:-:-] search  [%s]p[-:-:-] ping  [%s]d[-:-:-] delete  [%s]t[-:-:-] theme  [%s]↑/↓[-:-:-] navigate  [%s]enter[-:-:-] connect  [%s]?[-:-:-] help",
-		accent, accent, accent, accent, accent, accent, accent, accent,
+	footer := fmt.Sprintf("[::b][%s]q[-:-:-] quit  [%s]:[-:-:-] search  [%s]p[-:-:-] ping  [%s]a[-:-:-] add  [%s]e[-:-:-] edit  [%s]d[-:-:-] delete  [%s]t[-:-:-] theme  [%s]↑/↓[-:-:-] navigate  [%s]enter[-:-:-] connect  [%s]?[-:-:-] help",
+		accent, accent, accent, accent, accent, accent, accent, accent, accent, accent,
 	)
 	state.Footer.SetText(footer)
 }
@@ -1209,10 +1822,13 @@ func getAppConfigPath() string {
 	return filepath.Join(configDir, "config.yml")
 }
 
-func (state *AppState) loadAppConfig() {
+// readAppConfig loads the 55h settings file. Missing files and unknown keys
+// are ignored so older and newer config files keep working.
+func readAppConfig() AppConfig {
+	cfg := AppConfig{}
 	configPath := getAppConfigPath()
 	if configPath == "" {
-		return
+		return cfg
 	}
 
 	// Try multiple candidate files for backward compatibility:
@@ -1237,27 +1853,23 @@ func (state *AppState) loadAppConfig() {
 		}
 	}
 	if err != nil || len(data) == 0 {
-		return
+		return cfg
 	}
 
+	values := map[string]string{}
 	// Attempt JSON if file looks like JSON or has .json extension
 	trimmed := strings.TrimSpace(string(data))
-	var found string
 	if strings.HasSuffix(used, ".json") || strings.HasPrefix(trimmed, "{") {
 		var obj map[string]interface{}
 		if jerr := json.Unmarshal(data, &obj); jerr == nil {
-			// support keys: theme, theme_name
-			if v, ok := obj["theme"]; ok {
+			for k, v := range obj {
 				if s, ok := v.(string); ok {
-					found = s
+					values[strings.ToLower(k)] = s
 				}
 			}
-			if found == "" {
-				if v, ok := obj["theme_name"]; ok {
-					if s, ok := v.(string); ok {
-						found = s
-					}
-				}
+			// support keys: theme, theme_name
+			if values["theme"] == "" {
+				values["theme"] = values["theme_name"]
 			}
 		}
 	} else {
@@ -1278,54 +1890,90 @@ func (state *AppState) loadAppConfig() {
 				continue
 			}
 			key := strings.ToLower(strings.TrimSpace(parts[0]))
-			val := strings.TrimSpace(parts[1])
-			if key == "theme" {
-				found = val
-				break
+			if _, dup := values[key]; !dup {
+				values[key] = strings.TrimSpace(parts[1])
 			}
 		}
 	}
 
-	if found == "" {
-		return
+	cfg.ThemeName = values["theme"]
+	cfg.ConnectMode = values["connect_mode"]
+	for _, mode := range groupModes {
+		if values["group_by"] == mode {
+			cfg.GroupBy = mode
+		}
 	}
-
-	// Find theme by name (case-sensitive match as names are defined)
-	for i, theme := range state.ThemeCatalog {
-		if theme.Name == found {
-			state.ThemeIndex = i
-			return
+	for _, mode := range sortModes {
+		if values["sort"] == mode {
+			cfg.Sort = mode
 		}
 	}
-	// if not found, leave ThemeIndex as-is (fallback)
+	cfg.AddFile = values["add_file"]
+	return cfg
 }
 
-func (state *AppState) saveAppConfig() {
+// writeAppConfig saves the settings as commented key/value lines.
+func writeAppConfig(cfg AppConfig) error {
 	configPath := getAppConfigPath()
 	if configPath == "" {
-		return
+		return fmt.Errorf("unable to resolve config path")
 	}
 
 	// Ensure config directory exists
 	configDir := filepath.Dir(configPath)
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return
+		return err
 	}
 
-	// Write simple key/value config with an English comment describing the setting
+	// Write simple key/value config with an English comment describing each setting
 	// Format:
 	// # Theme name for UI colors
 	// theme: <Name>
-	content := fmt.Sprintf("# Theme name for UI colors\ntheme: %s\n", state.currentTheme().Name)
-	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Theme name for UI colors\ntheme: %s\n", cfg.ThemeName))
+	if cfg.ConnectMode != "" {
+		sb.WriteString(fmt.Sprintf("# Enter key: exec (replace 55h with ssh) or return (back to the list after ssh exits)\nconnect_mode: %s\n", cfg.ConnectMode))
+	}
+	if cfg.GroupBy != "" {
+		sb.WriteString(fmt.Sprintf("# Host list grouping: file, domain or prefix (g cycles it)\ngroup_by: %s\n", cfg.GroupBy))
+	}
+	if cfg.Sort != "" {
+		sb.WriteString(fmt.Sprintf("# Host list order: config, alpha, recent, frecency or check (S cycles it)\nsort: %s\n", cfg.Sort))
+	}
+	if cfg.AddFile != "" {
+		sb.WriteString(fmt.Sprintf("# File new hosts are added to; it must be reached by an Include of the main config\nadd_file: %s\n", cfg.AddFile))
+	}
+	if err := os.WriteFile(configPath, []byte(sb.String()), 0644); err != nil {
 		// If we failed to write the new config, do not remove legacy files.
-		return
+		return err
 	}
 
 	// After successfully writing config.yml, attempt to remove legacy files
 	// from the same config directory. Ignore any errors from removal.
 	_ = os.Remove(filepath.Join(configDir, "config"))
 	_ = os.Remove(filepath.Join(configDir, "config.json"))
+	return nil
+}
+
+func (state *AppState) loadAppConfig() {
+	state.Config = readAppConfig()
+	if state.Config.ThemeName == "" {
+		return
+	}
+
+	// Find theme by name (case-sensitive match as names are defined)
+	for i, theme := range state.ThemeCatalog {
+		if theme.Name == state.Config.ThemeName {
+			state.ThemeIndex = i
+			return
+		}
+	}
+	// if not found, leave ThemeIndex as-is (fallback)
+}
+
+func (state *AppState) saveAppConfig() {
+	state.Config.ThemeName = state.currentTheme().Name
+	_ = writeAppConfig(state.Config)
 }
 
 func getAccessLogPath() string {
@@ -1337,9 +1985,37 @@ func getAccessLogPath() string {
 	return filepath.Join(configDir, "access.json")
 }
 
+// AccessRecord is the access.json entry for one host: when it was first and
+// last connected to, how often, and how long sessions that returned to 55h
+// lasted in total.
+type AccessRecord struct {
+	LastAccess     string `json:"last_access"`
+	LastSessionEnd string `json:"last_session_end,omitempty"`
+	Count          int    `json:"count,omitempty"`
+	FirstAccess    string `json:"first_access,omitempty"`
+	SessionSeconds int64  `json:"session_seconds,omitempty"`
+}
+
+// UnmarshalJSON also accepts the original format, where each host mapped to
+// a bare RFC3339 timestamp string.
+func (record *AccessRecord) UnmarshalJSON(data []byte) error {
+	var ts string
+	if err := json.Unmarshal(data, &ts); err == nil {
+		*record = AccessRecord{LastAccess: ts}
+		return nil
+	}
+	type plain AccessRecord
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*record = AccessRecord(decoded)
+	return nil
+}
+
 func (state *AppState) loadAccessLog() {
 	if state.LastAccess == nil {
-		state.LastAccess = map[string]string{}
+		state.LastAccess = map[string]AccessRecord{}
 	}
 	path := getAccessLogPath()
 	if path == "" {
@@ -1349,7 +2025,7 @@ func (state *AppState) loadAccessLog() {
 	if err != nil || len(data) == 0 {
 		return
 	}
-	var payload map[string]string
+	var payload map[string]AccessRecord
 	if err := json.Unmarshal(data, &payload); err != nil {
 		return
 	}
@@ -1360,13 +2036,45 @@ func (state *AppState) loadAccessLog() {
 
 func (state *AppState) recordAccess(entry HostEntry) {
 	if state.LastAccess == nil {
-		state.LastAccess = map[string]string{}
+		state.LastAccess = map[string]AccessRecord{}
 	}
 	key := accessKey(entry)
 	if key == "" {
 		return
 	}
-	state.LastAccess[key] = time.Now().Format(time.RFC3339)
+	record := state.LastAccess[key]
+	record.LastAccess = time.Now().Format(time.RFC3339)
+	if record.FirstAccess == "" {
+		record.FirstAccess = record.LastAccess
+	}
+	record.Count++
+	state.LastAccess[key] = record
+	state.saveAccessLog()
+}
+
+// recordSessionEnd stores when an ssh session started from 55h finished and
+// adds its length to the host's session time.
+func (state *AppState) recordSessionEnd(entry HostEntry, start time.Time, end time.Time) {
+	if state.LastAccess == nil {
+		state.LastAccess = map[string]AccessRecord{}
+	}
+	key := accessKey(entry)
+	record := state.LastAccess[key]
+	record.LastSessionEnd = end.Format(time.RFC3339)
+	record.SessionSeconds += int64(end.Sub(start).Seconds())
+	state.LastAccess[key] = record
+	state.saveAccessLog()
+}
+
+// moveAccessRecord re-keys a host's access history after an edit changed
+// the alias, HostName, User or Port that accessKey is built from.
+func (state *AppState) moveAccessRecord(oldKey, newKey string) {
+	record, ok := state.LastAccess[oldKey]
+	if !ok || oldKey == newKey {
+		return
+	}
+	delete(state.LastAccess, oldKey)
+	state.LastAccess[newKey] = record
 	state.saveAccessLog()
 }
 
@@ -1395,26 +2103,6 @@ func shortenPath(path string, max int) string {
 	return "..." + path[len(path)-(max-3):]
 }
 
-func fuzzyMatch(query string, target string) bool {
-	if strings.TrimSpace(query) == "" {
-		return true
-	}
-	needle := []rune(strings.ToLower(query))
-	if len(needle) == 0 {
-		return true
-	}
-	index := 0
-	for _, r := range target {
-		if unicode.ToLower(r) == needle[index] {
-			index++
-			if index == len(needle) {
-				return true
-			}
-		}
-	}
-	return false
-}
-
 func parseBoolVal(s string) (*bool, bool) {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "yes", "true", "1":
@@ -1440,7 +2128,82 @@ func parseIntVal(s string) (*int, bool) {
 	return &v, true
 }
 
+// splitArgs splits an argument string on whitespace, keeping double-quoted
+// sections together and stripping the quotes.
+func splitArgs(value string) []string {
+	args := []string{}
+	var current strings.Builder
+	inQuotes := false
+	hasToken := false
+	for _, r := range value {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasToken = true
+		case unicode.IsSpace(r) && !inQuotes:
+			if hasToken {
+				args = append(args, current.String())
+				current.Reset()
+				hasToken = false
+			}
+		default:
+			current.WriteRune(r)
+			hasToken = true
+		}
+	}
+	if hasToken {
+		args = append(args, current.String())
+	}
+	return args
+}
+
+// parseMatchCriteria parses the arguments of a Match line. Every keyword takes
+// one argument except all, canonical and final.
+func parseMatchCriteria(value string) []MatchCriterion {
+	args := splitArgs(value)
+	criteria := []MatchCriterion{}
+	for i := 0; i < len(args); i++ {
+		keyword := strings.ToLower(args[i])
+		negated := strings.HasPrefix(keyword, "!")
+		keyword = strings.TrimPrefix(keyword, "!")
+		criterion := MatchCriterion{Keyword: keyword, Negated: negated}
+		switch keyword {
+		case "all", "canonical", "final":
+		default:
+			if i+1 < len(args) {
+				criterion.Value = args[i+1]
+				i++
+			}
+		}
+		criteria = append(criteria, criterion)
+	}
+	return criteria
+}
+
 func loadSSHConfig(path string) ([]HostEntry, error) {
+	blocks, err := loadSSHConfigBlocks(path)
+	if err != nil {
+		return nil, err
+	}
+	return withoutGlobalBlocks(blocks), nil
+}
+
+// withoutGlobalBlocks keeps the Host and Match blocks shown in the host list.
+func withoutGlobalBlocks(blocks []HostEntry) []HostEntry {
+	entries := []HostEntry{}
+	for _, block := range blocks {
+		if block.Kind == BlockGlobal {
+			continue
+		}
+		entries = append(entries, block)
+	}
+	return entries
+}
+
+// loadSSHConfigBlocks parses the config and every Include target into blocks
+// in the order ssh reads them, including the global blocks that loadSSHConfig
+// leaves out. The order matters for option resolution (first value wins).
+func loadSSHConfigBlocks(path string) ([]HostEntry, error) {
 	if path == "" {
 		return nil, fmt.Errorf("missing config path")
 	}
@@ -1452,9 +2215,13 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 
 	visited := make(map[string]bool)
 	entries := []HostEntry{}
+	// seq numbers headers and directives in reading order. Blocks are
+	// flushed after any files they include, so they are sorted back by it at
+	// the end, and options after an Include come after the included ones.
+	seq := 0
 
-	var loadFile func(string) error
-	loadFile = func(p string) error {
+	var loadFile func(string, *HostEntry) error
+	loadFile = func(p string, within *HostEntry) error {
 		abs, err := filepath.Abs(p)
 		if err == nil {
 			p = abs
@@ -1464,16 +2231,21 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 		}
 		visited[p] = true
 
-		f, err := os.Open(p)
+		data, err := os.ReadFile(p)
 		if err != nil {
 			// If top-level caller provided a path we already checked it exists.
 			// For includes, callers should check existence before calling.
 			return err
 		}
-		defer f.Close()
+		doc := parseConfigDocumentBytes(p, data)
 
-		scanner := bufio.NewScanner(f)
 		var current *HostEntry
+		begin := func(entry *HostEntry) {
+			current = entry
+			current.Seq = seq
+			current.Within = within
+			seq++
+		}
 		flush := func() {
 			if current == nil {
 				return
@@ -1487,24 +2259,53 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 
 		dir := filepath.Dir(p)
 
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
+		// pending holds "# 55h:" comments not yet tied to a block. A header
+		// right below them takes them; otherwise they belong to the block
+		// they sit in.
+		var pending *HostMeta
+		attach := func() {
+			if pending != nil && current != nil && current.Kind != BlockGlobal {
+				current.Meta.merge(*pending)
 			}
-			fields := strings.Fields(line)
-			if len(fields) == 0 {
+			pending = nil
+		}
+
+		for i, line := range doc.Lines {
+			lineNo := i + 1
+			if !line.IsDirective() {
+				if meta, ok := parseMetaComment(line.Raw); ok {
+					meta.Lines = []int{lineNo}
+					if pending == nil {
+						pending = &HostMeta{}
+					}
+					pending.merge(meta)
+				} else if line.IsBlank() {
+					attach()
+				}
 				continue
 			}
-			key := strings.ToLower(fields[0])
-
+			rawKey, value := line.Key, line.Value
+			key := line.Keyword()
+			if key != "host" && key != "match" {
+				attach()
+			}
 			if key == "include" {
-				// Expand include patterns (supports multiple patterns on one line)
-				for _, pat := range fields[1:] {
-					// Resolve relative paths against current file dir
-					if !filepath.IsAbs(pat) {
-						pat = filepath.Join(dir, pat)
+				// Inside a Host or Match block the included files apply only
+				// when that block matches.
+				scope := within
+				if current != nil {
+					current.EndLine = lineNo
+					if current.Kind == BlockGlobal {
+						// Global directives after the Include come later in
+						// reading order than the included blocks.
+						flush()
+					} else {
+						scope = &HostEntry{Kind: current.Kind, Patterns: current.Patterns, Criteria: current.Criteria, SourcePath: p, StartLine: current.StartLine, Seq: current.Seq, Within: current.Within}
 					}
+				}
+				// Expand include patterns (supports multiple patterns on one line)
+				for _, pat := range splitArgs(value) {
+					pat = includePattern(dir, pat)
 					// Glob expansion
 					matches, gerr := filepath.Glob(pat)
 					if gerr != nil || len(matches) == 0 {
@@ -1512,7 +2313,7 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 						if strings.IndexAny(pat, "*?[]") == -1 {
 							if _, sterr := os.Stat(pat); sterr == nil {
 								// single file exists
-								_ = loadFile(pat)
+								_ = loadFile(pat, scope)
 							}
 						}
 						continue
@@ -1522,7 +2323,7 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 						if _, statErr := os.Stat(m); statErr != nil {
 							continue
 						}
-						_ = loadFile(m)
+						_ = loadFile(m, scope)
 					}
 				}
 				continue
@@ -1530,19 +2331,45 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 
 			if key == "host" {
 				flush()
-				if len(fields) > 1 {
-					current = &HostEntry{Patterns: fields[1:], SourcePath: p}
-				} else {
-					current = &HostEntry{Patterns: []string{}, SourcePath: p}
+				begin(&HostEntry{Kind: BlockHost, Patterns: splitArgs(value), SourcePath: p, StartLine: lineNo, EndLine: lineNo})
+				if pending != nil {
+					current.Meta, pending = *pending, nil
+				}
+				continue
+			}
+
+			if key == "match" {
+				// Match opens its own block; options below it must not leak
+				// into the preceding Host entry.
+				flush()
+				begin(&HostEntry{Kind: BlockMatch, Patterns: []string{}, Criteria: parseMatchCriteria(value), SourcePath: p, StartLine: lineNo, EndLine: lineNo})
+				if pending != nil {
+					current.Meta, pending = *pending, nil
 				}
 				continue
 			}
 
 			if current == nil {
+				begin(&HostEntry{Kind: BlockGlobal, Patterns: []string{}, SourcePath: p, StartLine: lineNo})
+			}
+			current.EndLine = lineNo
+			option := ConfigOption{
+				Key:        canonicalKeyword(rawKey),
+				Value:      value,
+				SourcePath: p,
+				Line:       lineNo,
+				Seq:        seq,
+			}
+			seq++
+
+			_, alreadySet := current.Option(rawKey)
+			current.Options = append(current.Options, option)
+			if alreadySet {
+				// ssh uses the first value of a key; later ones are kept in
+				// Options but don't replace the typed field.
 				continue
 			}
 
-			value := strings.TrimSpace(strings.Join(fields[1:], " "))
 			switch key {
 			case "hostname":
 				current.HostName = value
@@ -1573,18 +2400,18 @@ func loadSSHConfig(path string) ([]HostEntry, error) {
 			}
 		}
 
-		if err := scanner.Err(); err != nil {
-			return err
-		}
-
+		attach()
 		flush()
 		return nil
 	}
 
-	if err := loadFile(path); err != nil {
+	if err := loadFile(path, nil); err != nil {
 		return nil, err
 	}
 
+	sort.SliceStable(entries, func(a, b int) bool {
+		return entries[a].Seq < entries[b].Seq
+	})
 	return entries, nil
 }
 
@@ -1596,79 +2423,78 @@ func formatBoolYesNo(b bool) string {
 }
 
 // handleAddSSH implements: 55h add ssh user@host [-p port] [-i identity] [-J jump] [-o Key=Value ...] [--name alias]
-func handleAddSSH(args []string, configPath string) error {
-	if len(args) == 0 {
-		return fmt.Errorf("usage: 55h add ssh user@host [-p port] [-i identity] [-J jump] [-o Key=Value ...] [--name alias]")
+func handleAddSSH(inv *cliInvocation) error {
+	from := inv.Value("from")
+	if len(inv.Args) > 1 || (len(inv.Args) == 0 && from == "") {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+
+	target := ""
+	if len(inv.Args) == 1 {
+		target = inv.Args[0]
 	}
+	port, identity, jump, name := inv.Value("port"), inv.Value("identity"), inv.Value("jump"), inv.Value("name")
+	configPath := inv.ConfigPath
 
-	target := args[0]
-	var port, identity, jump, name string
+	// --from copies an existing block; the alias suggestion counts up its own
+	var source *HostEntry
+	var entries []HostEntry
+	if from != "" {
+		loaded, err := loadSSHConfig(configPath)
+		if err != nil {
+			return err
+		}
+		entry, err := findHostEntry(loaded, from)
+		if err != nil {
+			return err
+		}
+		source, entries = &entry, loaded
+	}
 	var serverAliveInterval *int
 	var serverAliveCountMax *int
 	var forwardAgent *bool
 	var identitiesOnly *bool
+	var extraOptions [][2]string
 
-	for i := 1; i < len(args); i++ {
-		a := args[i]
-		switch a {
-		case "-p":
-			if i+1 >= len(args) {
-				return fmt.Errorf("-p requires a value")
-			}
-			port = args[i+1]
-			i++
-		case "-i":
-			if i+1 >= len(args) {
-				return fmt.Errorf("-i requires a value")
+	for _, kv := range inv.Values("option") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("-o expects Key=Value, got %q", kv)
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		val := strings.TrimSpace(parts[1])
+		switch key {
+		case "identitiesonly":
+			b, ok := parseBoolVal(val)
+			if !ok {
+				return fmt.Errorf("-o %s: IdentitiesOnly must be yes or no", kv)
 			}
-			identity = args[i+1]
-			i++
-		case "-J":
-			if i+1 >= len(args) {
-				return fmt.Errorf("-J requires a value")
+			identitiesOnly = b
+		case "serveraliveinterval", "serveralivecountmax":
+			v, ok := parseIntVal(val)
+			if !ok || *v < 0 {
+				return fmt.Errorf("-o %s: %s must be a non-negative number", kv, canonicalKeyword(key))
 			}
-			jump = args[i+1]
-			i++
-		case "-o":
-			if i+1 >= len(args) {
-				return fmt.Errorf("-o requires Key=Value")
+			if key == "serveraliveinterval" {
+				serverAliveInterval = v
+			} else {
+				serverAliveCountMax = v
 			}
-			kv := args[i+1]
-			i++
-			parts := strings.SplitN(kv, "=", 2)
-			if len(parts) != 2 {
+		case "forwardagent":
+			if b, ok := parseBoolVal(val); ok {
+				forwardAgent = b
 				continue
 			}
-			key := strings.ToLower(strings.TrimSpace(parts[0]))
-			val := strings.TrimSpace(parts[1])
-			switch key {
-			case "forwardagent":
-				if b, ok := parseBoolVal(val); ok {
-					forwardAgent = b
-				}
-			case "identitiesonly":
-				if b, ok := parseBoolVal(val); ok {
-					identitiesOnly = b
-				}
-			case "serveraliveinterval":
-				if v, ok := parseIntVal(val); ok {
-					serverAliveInterval = v
-				}
-			case "serveralivecountmax":
-				if v, ok := parseIntVal(val); ok {
-					serverAliveCountMax = v
-				}
-			default:
-				// ignore unknown -o keys
-			}
-		case "--name":
-			if i+1 >= len(args) {
-				return fmt.Errorf("--name requires a value")
+			// ForwardAgent also takes an agent socket path or $VARIABLE,
+			// which is written like any other option
+			if val == "" || !strings.ContainsRune("/~$", rune(val[0])) {
+				return fmt.Errorf("-o %s: ForwardAgent must be yes, no, a socket path or $VARIABLE", kv)
 			}
-			name = args[i+1]
-			i++
+			fallthrough
 		default:
-			return fmt.Errorf("unknown argument: %s", a)
+			// Any other keyword is written as given, after the typed ones,
+			// once the alias is known and it passes checkHostOption
+			extraOptions = append(extraOptions, [2]string{strings.TrimSpace(parts[0]), val})
 		}
 	}
 
@@ -1691,6 +2517,9 @@ func handleAddSSH(args []string, configPath string) error {
 	if user != "" && host != "" {
 		defaultAlias = fmt.Sprintf("%s@%s", user, host)
 	}
+	if source != nil {
+		defaultAlias = cloneForm(*source, entries).Patterns[0]
+	}
 
 	if name == "" {
 		if isTTY {
@@ -1718,69 +2547,153 @@ func handleAddSSH(args []string, configPath string) error {
 			return fmt.Errorf("--name is required when stdin is not a TTY")
 		}
 	}
+	if err := checkSingleAlias(name); err != nil {
+		return err
+	}
+	blocks, _ := loadSSHConfigBlocks(configPath)
+	var existing [][2]string
+	if source != nil {
+		existing = formFromEntry(source).Extras
+	}
+	policy := newKeywordPolicy(blocks, name, existing)
+	for i, opt := range extraOptions {
+		canonical, err := checkHostOption(opt[0], opt[1], policy)
+		if err != nil {
+			return fmt.Errorf("-o %s=%s: %v", opt[0], opt[1], err)
+		}
+		extraOptions[i][0] = canonical
+	}
 
 	// Ensure parent dir exists
 	cfg := configPath
 	if cfg == "" {
 		return fmt.Errorf("unable to resolve config path")
 	}
-	if err := os.MkdirAll(filepath.Dir(cfg), 0755); err != nil {
-		return fmt.Errorf("failed to create parent dir: %v", err)
+	// --file, else add_file from config.yml, picks an included file instead
+	// A clone goes next to its source unless --file says otherwise
+	file := inv.Value("file")
+	if file == "" && source == nil {
+		file = readAppConfig().AddFile
 	}
-
-	// Check for duplicate alias in existing config (including includes)
-	if entries, lerr := loadSSHConfig(cfg); lerr == nil {
-		for _, e := range entries {
-			for _, p := range e.Patterns {
-				if p == name {
-					return fmt.Errorf("alias %s already exists in %s", name, cfg)
-				}
-			}
+	if file != "" {
+		if cfg, err = resolveTargetFile(configPath, file); err != nil {
+			return err
 		}
 	}
+	if err := os.MkdirAll(filepath.Dir(cfg), 0755); err != nil {
+		return fmt.Errorf("failed to create parent dir: %v", err)
+	}
 
 	// Build host block
-	var sb strings.Builder
-	sb.WriteString("\n")
-	sb.WriteString(fmt.Sprintf("Host %s\n", name))
+	options := [][2]string{}
 	if host != "" {
-		sb.WriteString(fmt.Sprintf("    HostName %s\n", host))
+		options = append(options, [2]string{"HostName", host})
 	}
 	if user != "" {
-		sb.WriteString(fmt.Sprintf("    User %s\n", user))
+		options = append(options, [2]string{"User", user})
 	}
 	if port != "" {
-		sb.WriteString(fmt.Sprintf("    Port %s\n", port))
+		options = append(options, [2]string{"Port", port})
 	}
 	if identity != "" {
-		sb.WriteString(fmt.Sprintf("    IdentityFile %s\n", identity))
+		options = append(options, [2]string{"IdentityFile", identity})
 	}
 	if jump != "" {
-		sb.WriteString(fmt.Sprintf("    ProxyJump %s\n", jump))
+		options = append(options, [2]string{"ProxyJump", jump})
 	}
 	if forwardAgent != nil {
-		sb.WriteString(fmt.Sprintf("    ForwardAgent %s\n", formatBoolYesNo(*forwardAgent)))
+		options = append(options, [2]string{"ForwardAgent", formatBoolYesNo(*forwardAgent)})
 	}
 	if identitiesOnly != nil {
-		sb.WriteString(fmt.Sprintf("    IdentitiesOnly %s\n", formatBoolYesNo(*identitiesOnly)))
+		options = append(options, [2]string{"IdentitiesOnly", formatBoolYesNo(*identitiesOnly)})
 	}
 	if serverAliveInterval != nil {
-		sb.WriteString(fmt.Sprintf("    ServerAliveInterval %d\n", *serverAliveInterval))
+		options = append(options, [2]string{"ServerAliveInterval", fmt.Sprintf("%d", *serverAliveInterval)})
 	}
 	if serverAliveCountMax != nil {
-		sb.WriteString(fmt.Sprintf("    ServerAliveCountMax %d\n", *serverAliveCountMax))
+		options = append(options, [2]string{"ServerAliveCountMax", fmt.Sprintf("%d", *serverAliveCountMax)})
+	}
+	if source != nil {
+		if file == "" {
+			cfg = ""
+		}
+		return addClone(*source, entries, name, cfg, options, extraOptions)
 	}
+	options = append(options, extraOptions...)
 
-	// Append to file
-	f, err := os.OpenFile(cfg, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open config file: %v", err)
+	// Check the block as the editor form would, including duplicate aliases
+	// across included files
+	form := hostForm{Patterns: []string{name}, Values: map[string]string{}}
+	for _, opt := range options {
+		if _, set := form.Values[opt[0]]; !set && typedOptionKeys[strings.ToLower(opt[0])] {
+			form.Values[opt[0]] = opt[1]
+		} else {
+			form.Extras = append(form.Extras, opt)
+		}
+	}
+	if err := validateHostForm(form, withoutGlobalBlocks(blocks), nil); err != nil {
+		return err
 	}
-	defer f.Close()
 
-	if _, err := f.WriteString(sb.String()); err != nil {
+	doc, err := parseConfigDocument(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	doc.AddHostBlock([]string{name}, options)
+	if err := doc.Save("add " + name); err != nil {
 		return fmt.Errorf("failed to write config: %v", err)
 	}
 
 	return nil
 }
+
+// addClone writes a copy of source named name. Options given on the command
+// line replace every copied value of their key. The copy goes right after
+// source in its file, or to the end of path when one is given.
+func addClone(source HostEntry, entries []HostEntry, name, path string, typed, extras [][2]string) error {
+	form := cloneForm(source, entries)
+	form.Patterns = []string{name}
+	replaced := map[string]bool{}
+	for _, opt := range append(typed, extras...) {
+		key := strings.ToLower(opt[0])
+		first := !replaced[key]
+		if first {
+			replaced[key] = true
+			kept := [][2]string{}
+			for _, extra := range form.Extras {
+				if strings.ToLower(extra[0]) != key {
+					kept = append(kept, extra)
+				}
+			}
+			form.Extras = kept
+		}
+		if first && typedOptionKeys[key] {
+			form.Values[canonicalKeyword(key)] = opt[1]
+		} else {
+			form.Extras = append(form.Extras, opt)
+		}
+	}
+	if err := validateHostForm(form, entries, nil); err != nil {
+		return err
+	}
+
+	if path == "" {
+		path = source.SourcePath
+	}
+	doc, err := parseConfigDocument(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if path == source.SourcePath {
+		err = insertClone(doc, form, source)
+	} else {
+		doc.appendBlock(newHostLines(doc, form))
+	}
+	if err != nil {
+		return err
+	}
+	if err := doc.Save("clone " + firstPattern(source) + " " + name); err != nil {
+		return fmt.Errorf("failed to write config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rivo/tview"
+)
+
+// Scores follow fzf: every matched character is worth scoreMatch, gaps cost
+// a little, and characters that start a word or continue a run earn a bonus.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	bonusBoundary     = scoreMatch / 2
+	bonusConsecutive  = -(scoreGapStart + scoreGapExtension)
+	bonusFirstChar    = 2
+	// bonusAlias lifts a term found in the alias above the same term found
+	// only in an option value.
+	bonusAlias = 2 * scoreMatch
+)
+
+// queryTerms splits a search query into lowercase terms. Every term has to
+// match, in any order, like space-separated terms in fzf.
+func queryTerms(query string) []string {
+	return strings.Fields(strings.ToLower(query))
+}
+
+// fuzzyScore matches term as a subsequence of target and returns the best
+// score with the rune positions that produced it.
+func fuzzyScore(term string, target string) (int, []int, bool) {
+	needle := lowerRunes(term)
+	hay := lowerRunes(target)
+	m, n := len(needle), len(hay)
+	if m == 0 {
+		return 0, nil, true
+	}
+	if m > n || !isSubsequence(needle, hay) {
+		return 0, nil, false
+	}
+
+	bonus := make([]int, n)
+	for j := range hay {
+		if j == 0 || !unicode.IsLetter(hay[j-1]) && !unicode.IsDigit(hay[j-1]) {
+			bonus[j] = bonusBoundary
+		}
+	}
+
+	// score[i][j] is the best score with needle[i] matched at hay[j];
+	// from[i][j] is where needle[i-1] was matched on that path. Both rows
+	// share one backing array each.
+	const none = -1 << 30
+	score := make([][]int, m)
+	from := make([][]int, m)
+	scoreCells, fromCells := make([]int, m*n), make([]int, m*n)
+	for i := range score {
+		score[i] = scoreCells[i*n : (i+1)*n]
+		from[i] = fromCells[i*n : (i+1)*n]
+		for j := range score[i] {
+			score[i][j] = none
+		}
+	}
+	for j := 0; j < n; j++ {
+		if hay[j] == needle[0] {
+			score[0][j] = scoreMatch + bonus[j]*bonusFirstChar
+		}
+	}
+	for i := 1; i < m; i++ {
+		// gap is the best score[i-1][k] for k < j-1, less the gap it leaves.
+		gap, gapFrom := none, -1
+		for j := i; j < n; j++ {
+			if j >= 2 {
+				if gap != none {
+					gap += scoreGapExtension
+				}
+				if prev := score[i-1][j-2]; prev != none && prev+scoreGapStart > gap {
+					gap, gapFrom = prev+scoreGapStart, j-2
+				}
+			}
+			if hay[j] != needle[i] {
+				continue
+			}
+			best, bestFrom := gap, gapFrom
+			if prev := score[i-1][j-1]; prev != none && prev+bonusConsecutive >= best {
+				best, bestFrom = prev+bonusConsecutive, j-1
+			}
+			if best == none {
+				continue
+			}
+			score[i][j] = best + scoreMatch + bonus[j]
+			from[i][j] = bestFrom
+		}
+	}
+
+	end := -1
+	for j := m - 1; j < n; j++ {
+		if score[m-1][j] != none && (end < 0 || score[m-1][j] > score[m-1][end]) {
+			end = j
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions := make([]int, m)
+	for i, j := m-1, end; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return score[m-1][end], positions, true
+}
+
+// isSubsequence reports whether needle occurs in hay in order, the cheap
+// test that spares most targets the scoring tables.
+func isSubsequence(needle, hay []rune) bool {
+	i := 0
+	for _, r := range hay {
+		if i < len(needle) && r == needle[i] {
+			i++
+		}
+	}
+	return i == len(needle)
+}
+
+// lowerRunes lowercases rune by rune so positions line up with the
+// original text.
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+// fuzzyMatch reports whether every term of query matches target.
+func fuzzyMatch(query string, target string) bool {
+	for _, term := range queryTerms(query) {
+		if _, _, ok := fuzzyScore(term, target); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// hostScore ranks entry for the query terms. Each term counts with its best
+// score in the alias, the list line or any searchable field.
+func hostScore(entry HostEntry, terms []string) (int, bool) {
+	alias := strings.Join(entry.Patterns, " ")
+	display, _ := entry.DisplayText()
+	search := entry.SearchText()
+	total := 0
+	for _, term := range terms {
+		best, found := 0, false
+		if s, _, ok := fuzzyScore(term, alias); ok && alias != "" {
+			best, found = s+bonusAlias, true
+		}
+		for _, text := range []string{display, search} {
+			if s, _, ok := fuzzyScore(term, text); ok && (!found || s > best) {
+				best, found = s, true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+		total += best
+	}
+	return total, true
+}
+
+// frecencyBoost favours hosts connected to recently and often, enough to
+// reorder close matches without outranking a clearly better one.
+func (state *AppState) frecencyBoost(entry HostEntry) int {
+	record, ok := state.LastAccess[accessKey(entry)]
+	if !ok {
+		return 0
+	}
+	boost := min(record.Count, 10)
+	if last, err := time.Parse(time.RFC3339, record.LastAccess); err == nil {
+		switch age := time.Since(last); {
+		case age < 24*time.Hour:
+			boost += 12
+		case age < 7*24*time.Hour:
+			boost += 8
+		case age < 30*24*time.Hour:
+			boost += 4
+		}
+	}
+	return boost
+}
+
+// rankEntries keeps the entries matching query, best first by their fuzzy
+// words. Ties keep the shorter alias first and then the config order, with
+// Match blocks, which have no alias, after the hosts.
+// Without fuzzy words the sort mode orders them; pinned hosts come first.
+func (state *AppState) rankEntries(entries []HostEntry, query *hostQuery) []HostEntry {
+	words := query.fuzzyWords()
+	type ranked struct {
+		entry HostEntry
+		score int
+		index int
+	}
+	matches := []ranked{}
+	for _, entry := range entries {
+		if !query.Match(entry) {
+			continue
+		}
+		score := 0
+		for _, word := range words {
+			// Words under OR may not all match; the ones that do count
+			if s, ok := hostScore(entry, []string{word}); ok {
+				score += s
+			}
+		}
+		matches = append(matches, ranked{entry, score, len(matches)})
+	}
+	if len(words) == 0 {
+		result := make([]HostEntry, len(matches))
+		for i, m := range matches {
+			result[i] = m.entry
+		}
+		return state.pinnedFirst(state.sortEntries(result))
+	}
+	for i := range matches {
+		matches[i].score += state.frecencyBoost(matches[i].entry)
+	}
+	aliasLength := func(entry HostEntry) int {
+		if len(entry.Patterns) == 0 {
+			return math.MaxInt
+		}
+		return len(entry.Patterns[0])
+	}
+	sort.Slice(matches, func(a, b int) bool {
+		if matches[a].score != matches[b].score {
+			return matches[a].score > matches[b].score
+		}
+		if la, lb := aliasLength(matches[a].entry), aliasLength(matches[b].entry); la != lb {
+			return la < lb
+		}
+		return matches[a].index < matches[b].index
+	})
+	result := make([]HostEntry, len(matches))
+	for i, m := range matches {
+		result[i] = m.entry
+	}
+	return state.pinnedFirst(result)
+}
+
+// highlightMatches escapes text for tview and wraps the characters the
+// query terms matched in openTag and closeTag.
+func highlightMatches(text string, terms []string, openTag string, closeTag string) string {
+	runes := []rune(text)
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		if _, positions, ok := fuzzyScore(term, text); ok {
+			for _, p := range positions {
+				marked[p] = true
+			}
+		}
+	}
+	var out strings.Builder
+	for start := 0; start < len(runes); {
+		end := start
+		for end < len(runes) && marked[end] == marked[start] {
+			end++
+		}
+		segment := tview.Escape(string(runes[start:end]))
+		if marked[start] {
+			out.WriteString(openTag + segment + closeTag)
+		} else {
+			out.WriteString(segment)
+		}
+		start = end
+	}
+	return out.String()
+}
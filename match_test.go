@@ -0,0 +1,108 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyScoreMatches(t *testing.T) {
+	tests := []struct {
+		term, target string
+		ok           bool
+		positions    []int
+	}{
+		{"", "web", true, nil},
+		{"web", "web-1", true, []int{0, 1, 2}},
+		{"WEB", "web-1", true, []int{0, 1, 2}},
+		{"wb", "web-1", true, []int{0, 2}},
+		{"w1", "web-1", true, []int{0, 4}},
+		{"xyz", "web-1", false, nil},
+		{"bew", "web", false, nil},
+		{"web-10", "web-1", false, nil},
+	}
+	for _, tt := range tests {
+		_, positions, ok := fuzzyScore(tt.term, tt.target)
+		if ok != tt.ok || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("fuzzyScore(%q, %q) = %v, %v, want %v, %v", tt.term, tt.target, positions, ok, tt.positions, tt.ok)
+		}
+	}
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	// Each pair lists a target that should outrank the other for the term.
+	tests := []struct {
+		name          string
+		term          string
+		better, worse string
+	}{
+		{"consecutive beats scattered", "web", "web-1", "wxexb"},
+		{"word start beats mid-word", "db", "prod-db", "oddbox"},
+		{"run at a word start beats run mid-word", "prod", "db-prod", "reproduce"},
+		{"shorter gap beats longer gap", "ab", "a-b", "a----b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			better, _, ok := fuzzyScore(tt.term, tt.better)
+			if !ok {
+				t.Fatalf("fuzzyScore(%q, %q) did not match", tt.term, tt.better)
+			}
+			worse, _, ok := fuzzyScore(tt.term, tt.worse)
+			if !ok {
+				t.Fatalf("fuzzyScore(%q, %q) did not match", tt.term, tt.worse)
+			}
+			if better <= worse {
+				t.Errorf("fuzzyScore(%q): %q scored %d, %q scored %d", tt.term, tt.better, better, tt.worse, worse)
+			}
+		})
+	}
+}
+
+func TestHostScoreAliasBonus(t *testing.T) {
+	alias := HostEntry{Kind: BlockHost, Patterns: []string{"prod"}, HostName: "10.0.0.1"}
+	hostname := HostEntry{Kind: BlockHost, Patterns: []string{"box"}, HostName: "prod"}
+
+	aliasScore, ok := hostScore(alias, []string{"prod"})
+	if !ok {
+		t.Fatal("hostScore did not match the alias")
+	}
+	hostnameScore, ok := hostScore(hostname, []string{"prod"})
+	if !ok {
+		t.Fatal("hostScore did not match the HostName")
+	}
+	if aliasScore <= hostnameScore {
+		t.Errorf("alias match scored %d, HostName match scored %d", aliasScore, hostnameScore)
+	}
+
+	if _, ok := hostScore(alias, []string{"prod", "nomatch"}); ok {
+		t.Error("hostScore matched although one term is missing")
+	}
+}
+
+func TestRankEntriesTies(t *testing.T) {
+	state := &AppState{}
+	entries := []HostEntry{
+		{Kind: BlockMatch, Criteria: parseMatchCriteria("host app")},
+		{Kind: BlockHost, Patterns: []string{"app-10"}},
+		{Kind: BlockHost, Patterns: []string{"app-2"}},
+		{Kind: BlockHost, Patterns: []string{"app-1"}},
+	}
+	query, err := parseHostQuery("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := func(ranked []HostEntry) []string {
+		got := []string{}
+		for _, entry := range ranked {
+			got = append(got, entryLabel(entry))
+		}
+		return got
+	}
+	// Equal scores: shorter alias first, then config order, Match last.
+	if got, want := labels(state.rankEntries(entries, query)), []string{"app-2", "app-1", "app-10", "Match host app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rankEntries = %q, want %q", got, want)
+	}
+	reversed := []HostEntry{entries[3], entries[2], entries[1], entries[0]}
+	if got, want := labels(state.rankEntries(reversed, query)), []string{"app-1", "app-2", "app-10", "Match host app"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rankEntries reversed = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// metaMarker starts the structured comments 55h reads and writes:
+//
+//	# 55h: tags=prod,db owner=payments note="primary replica"
+//
+// A comment directly above a Host or Match line belongs to that block; one
+// further down, inside the block, belongs to the block it is in. Keeping the
+// metadata in the config lets it travel with shared include files.
+const metaMarker = "55h:"
+
+// metaKeys are the metadata keys with fields of their own, in the order
+// they are written.
+var metaKeys = []string{"tags", "owner", "note"}
+
+// HostMeta is the metadata of one block.
+type HostMeta struct {
+	Tags  []string
+	Owner string
+	Note  string
+	// Other keeps keys 55h has no field for, so rewriting the comment
+	// doesn't drop them.
+	Other [][2]string
+	// Lines are the 1-based lines of the comments it was read from.
+	Lines []int
+}
+
+func (meta HostMeta) IsEmpty() bool {
+	return len(meta.Tags) == 0 && meta.Owner == "" && meta.Note == "" && len(meta.Other) == 0
+}
+
+// HasTag reports whether tag is one of the tags, ignoring case.
+func (meta HostMeta) HasTag(tag string) bool {
+	for _, t := range meta.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a metadata value by key; tags are joined with ",".
+func (meta HostMeta) Get(key string) string {
+	switch strings.ToLower(key) {
+	case "tags":
+		return strings.Join(meta.Tags, ",")
+	case "owner":
+		return meta.Owner
+	case "note":
+		return meta.Note
+	}
+	for _, kv := range meta.Other {
+		if strings.EqualFold(kv[0], key) {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// Set stores a metadata value by key; an empty value removes it.
+func (meta *HostMeta) Set(key, value string) {
+	switch strings.ToLower(key) {
+	case "tags":
+		meta.Tags = splitTags(value)
+		return
+	case "owner":
+		meta.Owner = value
+		return
+	case "note":
+		meta.Note = value
+		return
+	}
+	kept := [][2]string{}
+	for _, kv := range meta.Other {
+		if !strings.EqualFold(kv[0], key) {
+			kept = append(kept, kv)
+		}
+	}
+	if value != "" {
+		kept = append(kept, [2]string{key, value})
+	}
+	meta.Other = kept
+}
+
+// merge adds the values of a later comment: tags accumulate, other keys
+// take the later value.
+func (meta *HostMeta) merge(other HostMeta) {
+	for _, tag := range other.Tags {
+		if !meta.HasTag(tag) {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	if other.Owner != "" {
+		meta.Owner = other.Owner
+	}
+	if other.Note != "" {
+		meta.Note = other.Note
+	}
+	for _, kv := range other.Other {
+		meta.Set(kv[0], kv[1])
+	}
+	meta.Lines = append(meta.Lines, other.Lines...)
+}
+
+// Comment renders the metadata as one "# 55h:" comment.
+func (meta HostMeta) Comment() string {
+	parts := []string{}
+	for _, key := range metaKeys {
+		if value := meta.Get(key); value != "" {
+			parts = append(parts, key+"="+metaQuote(value))
+		}
+	}
+	for _, kv := range meta.Other {
+		parts = append(parts, kv[0]+"="+metaQuote(kv[1]))
+	}
+	return "# " + metaMarker + " " + strings.Join(parts, " ")
+}
+
+func metaQuote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\"'=\\#") {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+func splitTags(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseMetaComment reads a "# 55h:" comment line. ok is false for any other
+// line; a malformed pair is skipped rather than failing the whole file.
+func parseMetaComment(raw string) (HostMeta, bool) {
+	text := strings.TrimSpace(raw)
+	if !strings.HasPrefix(text, "#") {
+		return HostMeta{}, false
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "#"))
+	if !strings.HasPrefix(text, metaMarker) {
+		return HostMeta{}, false
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, metaMarker))
+
+	meta := HostMeta{}
+	for text != "" {
+		eq := strings.IndexAny(text, "= \t")
+		if eq <= 0 || text[eq] != '=' {
+			// A word without "=": skip it
+			next := strings.IndexAny(text, " \t")
+			if next < 0 {
+				break
+			}
+			text = strings.TrimSpace(text[next:])
+			continue
+		}
+		key := strings.ToLower(text[:eq])
+		text = text[eq+1:]
+		value := ""
+		if strings.HasPrefix(text, `"`) {
+			quoted, err := strconv.QuotedPrefix(text)
+			if err != nil {
+				// Unterminated quote: take the rest as the value
+				value, text = strings.TrimPrefix(text, `"`), ""
+			} else {
+				value, _ = strconv.Unquote(quoted)
+				text = text[len(quoted):]
+			}
+		} else {
+			end := strings.IndexAny(text, " \t")
+			if end < 0 {
+				end = len(text)
+			}
+			value, text = text[:end], text[end:]
+		}
+		text = strings.TrimSpace(text)
+		meta.Set(key, value)
+	}
+	return meta, true
+}
+
+func isMetaComment(raw string) bool {
+	_, ok := parseMetaComment(raw)
+	return ok
+}
+
+// metaRows are the Details rows for the metadata that is set.
+func metaRows(meta HostMeta) [][2]string {
+	rows := [][2]string{}
+	if len(meta.Tags) > 0 {
+		rows = append(rows, [2]string{"Tags", strings.Join(meta.Tags, ", ")})
+	}
+	if meta.Owner != "" {
+		rows = append(rows, [2]string{"Owner", meta.Owner})
+	}
+	if meta.Note != "" {
+		rows = append(rows, [2]string{"Note", meta.Note})
+	}
+	for _, kv := range meta.Other {
+		rows = append(rows, [2]string{kv[0], kv[1]})
+	}
+	return rows
+}
+
+// isMetaKey reports whether key names a metadata field rather than an ssh
+// option.
+func isMetaKey(key string) bool {
+	for _, k := range metaKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMeta rejects metadata that would not read back the same.
+func validateMeta(meta HostMeta) error {
+	for _, tag := range meta.Tags {
+		if strings.ContainsAny(tag, " \t\"") {
+			return fmt.Errorf("tag %q must not contain spaces or quotes", tag)
+		}
+	}
+	if strings.ContainsAny(meta.Owner+meta.Note, "\n\r") {
+		return fmt.Errorf("owner and note must be a single line")
+	}
+	return nil
+}
+
+// editMetaComment rewrites the metadata comments from old to meta. The
+// first existing comment is replaced in place; it returns the indexes of the
+// other comment lines, for the caller to remove together with its own, and
+// whether a new comment has to go directly above the header.
+func (doc *ConfigDocument) editMetaComment(old HostMeta, meta HostMeta) ([]int, bool) {
+	if metaEqual(old, meta) {
+		return nil, false
+	}
+	remove := []int{}
+	for i, lineNo := range old.Lines {
+		if i == 0 && !meta.IsEmpty() {
+			line := doc.Lines[lineNo-1]
+			line.Raw = line.Indent + meta.Comment()
+			continue
+		}
+		remove = append(remove, lineNo-1)
+	}
+	return remove, len(old.Lines) == 0 && !meta.IsEmpty()
+}
+
+func metaEqual(a, b HostMeta) bool {
+	return a.IsEmpty() == b.IsEmpty() && (a.IsEmpty() || a.Comment() == b.Comment())
+}
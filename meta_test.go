@@ -0,0 +1,176 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMetaComment(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want HostMeta
+		ok   bool
+	}{
+		{
+			name: "all fields",
+			raw:  "# 55h: tags=prod,db owner=payments note=\"primary replica\"",
+			want: HostMeta{Tags: []string{"prod", "db"}, Owner: "payments", Note: "primary replica"},
+			ok:   true,
+		},
+		{
+			name: "indented without a space after #",
+			raw:  "    #55h: owner=ops",
+			want: HostMeta{Owner: "ops"},
+			ok:   true,
+		},
+		{
+			name: "keys ignore case",
+			raw:  "# 55h: TAGS=a Owner=ops",
+			want: HostMeta{Tags: []string{"a"}, Owner: "ops"},
+			ok:   true,
+		},
+		{
+			name: "escapes in quotes",
+			raw:  `# 55h: note="say \"hi\" = #1"`,
+			want: HostMeta{Note: `say "hi" = #1`},
+			ok:   true,
+		},
+		{
+			name: "unknown keys are kept",
+			raw:  "# 55h: owner=ops ticket=OPS-12",
+			want: HostMeta{Owner: "ops", Other: [][2]string{{"ticket", "OPS-12"}}},
+			ok:   true,
+		},
+		{
+			name: "malformed pairs are skipped",
+			raw:  "# 55h: stray =x owner=ops",
+			want: HostMeta{Owner: "ops"},
+			ok:   true,
+		},
+		{
+			name: "unterminated quote takes the rest",
+			raw:  `# 55h: owner=ops note="to be continued`,
+			want: HostMeta{Owner: "ops", Note: "to be continued"},
+			ok:   true,
+		},
+		{
+			name: "empty tags",
+			raw:  "# 55h: tags=,,",
+			want: HostMeta{Tags: []string{}},
+			ok:   true,
+		},
+		{
+			name: "plain comment",
+			raw:  "# owner=ops",
+		},
+		{
+			name: "directive",
+			raw:  "User 55h:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseMetaComment(tt.raw)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetaCommentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		meta HostMeta
+		want string
+	}{
+		{
+			name: "plain values",
+			meta: HostMeta{Tags: []string{"prod", "db"}, Owner: "payments"},
+			want: "# 55h: tags=prod,db owner=payments",
+		},
+		{
+			name: "values that need quotes",
+			meta: HostMeta{Owner: "team a", Note: `a "b" = c # d \ e`},
+			want: `# 55h: owner="team a" note="a \"b\" = c # d \\ e"`,
+		},
+		{
+			name: "other keys after the fields",
+			meta: HostMeta{Note: "n", Other: [][2]string{{"ticket", "OPS-12"}, {"env", "x y"}}},
+			want: `# 55h: note=n ticket=OPS-12 env="x y"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := tt.meta.Comment()
+			if comment != tt.want {
+				t.Errorf("Comment() = %q, want %q", comment, tt.want)
+			}
+			got, ok := parseMetaComment(comment)
+			if !ok || !reflect.DeepEqual(got, tt.meta) {
+				t.Errorf("read back %+v, want %+v", got, tt.meta)
+			}
+		})
+	}
+}
+
+func TestEditMetaComment(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		edit   func(meta *HostMeta)
+		want   string
+	}{
+		{
+			name:   "new comment above the header",
+			config: "Host a\n\nHost web\n    HostName w\n",
+			edit:   func(meta *HostMeta) { meta.Set("owner", "ops") },
+			want:   "Host a\n\n# 55h: owner=ops\nHost web\n    HostName w\n",
+		},
+		{
+			name:   "comment inside the block rewritten in place",
+			config: "Host web\n    # 55h: owner=ops\n    HostName w\n",
+			edit:   func(meta *HostMeta) { meta.Set("tags", "prod") },
+			want:   "Host web\n    # 55h: tags=prod owner=ops\n    HostName w\n",
+		},
+		{
+			name:   "two comments merged into the first",
+			config: "# 55h: tags=prod\nHost web\n    # 55h: owner=ops\n    HostName w\n",
+			edit:   func(meta *HostMeta) { meta.Set("note", "n") },
+			want:   "# 55h: tags=prod owner=ops note=n\nHost web\n    HostName w\n",
+		},
+		{
+			name:   "unknown keys survive an edit",
+			config: "# 55h: owner=ops ticket=OPS-12\nHost web\n",
+			edit:   func(meta *HostMeta) { meta.Set("owner", "dba") },
+			want:   "# 55h: owner=dba ticket=OPS-12\nHost web\n",
+		},
+		{
+			name:   "cleared",
+			config: "# 55h: owner=ops\nHost web\n    HostName w\n",
+			edit:   func(meta *HostMeta) { meta.Set("owner", "") },
+			want:   "Host web\n    HostName w\n",
+		},
+		{
+			name:   "other comments are left alone",
+			config: "# the web host\n# 55h: owner=ops\nHost web\n",
+			edit:   func(meta *HostMeta) { meta.Set("owner", "dba") },
+			want:   "# the web host\n# 55h: owner=dba\nHost web\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editTestHost(t, tt.config, "web", func(form *hostForm) { tt.edit(&form.Meta) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
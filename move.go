@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// includePattern makes an Include argument absolute: "~/" is the home
+// directory and other relative paths are taken from dir, the directory of
+// the including file.
+func includePattern(dir, pattern string) string {
+	if strings.HasPrefix(pattern, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			pattern = filepath.Join(home, pattern[2:])
+		}
+	}
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	return pattern
+}
+
+// includedFiles walks the Include directives of the config at path like
+// the loader does. It returns the files read, the main config first, and
+// every Include pattern, which may also name files that don't exist yet.
+func includedFiles(path string) ([]string, []string) {
+	files, patterns := []string{}, []string{}
+	visited := map[string]bool{}
+	var walk func(p string)
+	walk = func(p string) {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if visited[p] {
+			return
+		}
+		visited[p] = true
+		doc, err := parseConfigDocument(p)
+		if err != nil {
+			return
+		}
+		files = append(files, p)
+		for _, line := range doc.Lines {
+			if !line.IsDirective() || line.Keyword() != "include" {
+				continue
+			}
+			for _, pat := range splitArgs(line.Value) {
+				pat = includePattern(filepath.Dir(p), pat)
+				patterns = append(patterns, pat)
+				matches, _ := filepath.Glob(pat)
+				for _, m := range matches {
+					if info, err := os.Stat(m); err == nil && !info.IsDir() {
+						walk(m)
+					}
+				}
+			}
+		}
+	}
+	walk(path)
+	return files, patterns
+}
+
+// resolveTargetFile turns a file named on the command line or in the move
+// dialog into an absolute path, taking relative names from the directory of
+// the main config, and checks that ssh would read it: it must be the main
+// config or match one of its Include patterns.
+func resolveTargetFile(configPath, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("no file given")
+	}
+	base := configPath
+	if abs, err := filepath.Abs(base); err == nil {
+		base = abs
+	}
+	target := includePattern(filepath.Dir(base), name)
+	if target == base {
+		return target, nil
+	}
+	files, patterns := includedFiles(base)
+	for _, file := range files {
+		if file == target {
+			return target, nil
+		}
+	}
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not reached by any Include of %s", target, base)
+}
+
+// moveHostEntry adds the block of entry, with the comments above it, to
+// target and removes it from its own file unless copy is set. It returns
+// the header line of the block in target.
+func moveHostEntry(changes *changeSet, entry HostEntry, target string, copy bool) (int, error) {
+	if entry.SourcePath == target {
+		return 0, fmt.Errorf("%s is already in %s", entryLabel(entry), target)
+	}
+	// Save writes files in the order they were opened. The destination goes
+	// first, so a failed write leaves the block in both files, never in
+	// neither.
+	dst, err := changes.open(target)
+	if err != nil {
+		return 0, err
+	}
+	src, err := changes.open(entry.SourcePath)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := findEntryBlock(src, entry); err != nil {
+		return 0, err
+	}
+	raw, err := src.BlockText(entry.StartLine)
+	if err != nil {
+		return 0, err
+	}
+	header, err := placeMovedBlock(dst, entry, raw)
+	if err != nil {
+		return 0, err
+	}
+	if !copy {
+		if err := src.RemoveBlock(entry.StartLine); err != nil {
+			return 0, err
+		}
+	}
+	return header, nil
+}
+
+// placeMovedBlock adds raw to doc above the first Match block or Host block
+// that also applies to one of entry's aliases. Since ssh takes the first
+// value it reads, appending after a trailing "Host *" would let its defaults
+// override the moved host's own User, Port and so on. A Match block or a
+// Host with only wildcard patterns is appended.
+func placeMovedBlock(doc *ConfigDocument, entry HostEntry, raw []string) (int, error) {
+	aliases := []string{}
+	if !entry.IsMatch() {
+		for _, p := range entry.Patterns {
+			if !strings.ContainsAny(p, "*?!") {
+				aliases = append(aliases, p)
+			}
+		}
+	}
+	if len(aliases) == 0 {
+		return doc.AppendBlock(raw), nil
+	}
+	for _, block := range doc.Blocks() {
+		applies := block.Kind == BlockMatch
+		for _, alias := range aliases {
+			if block.Kind == BlockHost && hostPatternsMatch(block.Patterns, alias) {
+				applies = true
+			}
+		}
+		if applies {
+			return doc.InsertBlockBefore(block.Header+1, doc.newLines(raw))
+		}
+	}
+	return doc.AppendBlock(raw), nil
+}
+
+// entryLabel names a block in messages and backup reasons.
+func entryLabel(entry HostEntry) string {
+	if entry.IsMatch() {
+		return "Match " + entry.CriteriaText()
+	}
+	return firstPattern(entry)
+}
+
+// handleMove implements: 55h mv <alias> <file> [--copy] [--at file:line] [--dry-run]
+func handleMove(inv *cliInvocation) error {
+	args, dryRun, copy := inv.Args, inv.Has("dry-run"), inv.Has("copy")
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s", inv.Command.usageLine())
+	}
+	entries, err := loadSSHConfig(inv.ConfigPath)
+	if err != nil {
+		return err
+	}
+	entry, err := selectHostEntry(inv, entries, args[0])
+	if err != nil {
+		return err
+	}
+	target, err := resolveTargetFile(inv.ConfigPath, args[1])
+	if err != nil {
+		return err
+	}
+
+	verb := "mv"
+	if copy {
+		verb = "cp"
+	}
+	changes := &changeSet{Reason: fmt.Sprintf("%s %s %s", verb, args[0], target)}
+	if _, err := moveHostEntry(changes, entry, target, copy); err != nil {
+		return err
+	}
+	fmt.Print(changes.Diff())
+	if dryRun {
+		return nil
+	}
+	if err := changes.Save(); err != nil {
+		return err
+	}
+	if copy {
+		fmt.Printf("copied %s to %s\n", args[0], target)
+	} else {
+		fmt.Printf("moved %s to %s\n", args[0], target)
+	}
+	return nil
+}
+
+// addTargetPath is the file new hosts go to: add_file from config.yml when
+// ssh reads it, else the main config.
+func (state *AppState) addTargetPath() string {
+	if state.Config.AddFile != "" {
+		if target, err := resolveTargetFile(state.ConfigPath, state.Config.AddFile); err == nil {
+			return target
+		}
+	}
+	return state.ConfigPath
+}
+
+// showMoveModal asks for the file to move (or copy) the selected block to.
+// The list offers the files already read; the input takes any path an
+// Include reaches, and the file is created if needed.
+func (state *AppState) showMoveModal(copy bool) {
+	entry, ok := state.selectedEntry()
+	if !ok || entry.Kind == BlockGlobal || entry.SourcePath == "" {
+		return
+	}
+
+	state.ThemeModalOpen = true
+	state.App.EnableMouse(false)
+
+	theme := state.currentTheme()
+	verb, past := "Move", "Moved"
+	if copy {
+		verb, past = "Copy", "Copied"
+	}
+	label := entryLabel(entry)
+
+	modalBox := tview.NewFlex().SetDirection(tview.FlexRow)
+	modalBox.SetBorder(true)
+	modalBox.SetTitle(fmt.Sprintf(" %s %s ", verb, tview.Escape(label)))
+	modalBox.SetTitleAlign(tview.AlignCenter)
+	modalBox.SetBackgroundColor(theme.PanelBg)
+	modalBox.SetBorderColor(theme.Border)
+	modalBox.SetTitleColor(theme.Text)
+
+	msgText := tview.NewTextView()
+	msgText.SetDynamicColors(true)
+	msgText.SetBackgroundColor(theme.PanelBg)
+	msgText.SetTextColor(theme.Text)
+	msgText.SetBorderPadding(0, 0, 1, 1)
+	msgText.SetText(fmt.Sprintf("From %s:%d to:", tview.Escape(state.relativeSourcePath(entry.SourcePath)), entry.StartLine))
+
+	files, _ := includedFiles(state.ConfigPath)
+	candidates := []string{}
+	for _, file := range files {
+		if file != entry.SourcePath {
+			candidates = append(candidates, file)
+		}
+	}
+
+	fileList := tview.NewList()
+	fileList.ShowSecondaryText(false)
+	fileList.SetHighlightFullLine(true)
+	fileList.SetBackgroundColor(theme.PanelBg)
+	fileList.SetMainTextColor(theme.Text)
+	fileList.SetSelectedBackgroundColor(theme.Accent)
+	fileList.SetSelectedTextColor(theme.Bg)
+	fileList.SetBorderPadding(0, 0, 1, 1)
+	for _, file := range candidates {
+		fileList.AddItem(tview.Escape(state.relativeSourcePath(file)), "", 0, nil)
+	}
+
+	pathInput := tview.NewInputField()
+	pathInput.SetLabel("File: ")
+	pathInput.SetPlaceholder("other file, e.g. config.d/work")
+	pathInput.SetFieldBackgroundColor(theme.Bg)
+	pathInput.SetFieldTextColor(theme.Text)
+	pathInput.SetLabelColor(theme.Label)
+	pathInput.SetPlaceholderTextColor(theme.Muted)
+	pathInput.SetBackgroundColor(theme.PanelBg)
+	pathInput.SetBorderPadding(0, 0, 1, 1)
+
+	errorText := tview.NewTextView()
+	errorText.SetDynamicColors(true)
+	errorText.SetTextAlign(tview.AlignCenter)
+	errorText.SetBackgroundColor(theme.PanelBg)
+
+	footerText := tview.NewTextView()
+	footerText.SetTextAlign(tview.AlignCenter)
+	footerText.SetTextColor(theme.Muted)
+	footerText.SetBackgroundColor(theme.PanelBg)
+	footerText.SetText(fmt.Sprintf("Enter %s  Tab list/path  Esc cancel", strings.ToLower(verb)))
+
+	listRows := min(max(len(candidates), 1), 10)
+	modalBox.AddItem(msgText, 1, 0, false)
+	modalBox.AddItem(fileList, listRows, 0, len(candidates) > 0)
+	modalBox.AddItem(pathInput, 1, 0, len(candidates) == 0)
+	modalBox.AddItem(errorText, 1, 0, false)
+	modalBox.AddItem(footerText, 1, 0, false)
+
+	closeModal := func() {
+		state.App.EnableMouse(true)
+		state.Pages.RemovePage("move-modal")
+		state.ThemeModalOpen = false
+		state.App.SetFocus(state.HostList)
+	}
+
+	apply := func(name string) {
+		header := 0
+		target, err := resolveTargetFile(state.ConfigPath, name)
+		if err == nil {
+			reason := fmt.Sprintf("%s %s %s", strings.ToLower(verb), label, target)
+			changes := &changeSet{Reason: reason}
+			if header, err = moveHostEntry(changes, entry, target, copy); err == nil {
+				err = changes.Save()
+			}
+		}
+		if err != nil {
+			errorText.SetText(fmt.Sprintf("[%s]%s[-]", theme.MarkupError, tview.Escape(err.Error())))
+			return
+		}
+		closeModal()
+		state.reload()
+		state.selectEntryAt(target, header)
+		state.setStatus(theme.MarkupAccent, fmt.Sprintf("%s %s to %s", past, label, state.relativeSourcePath(target)))
+	}
+
+	fileList.SetSelectedFunc(func(i int, _ string, _ string, _ rune) {
+		apply(candidates[i])
+	})
+	pathInput.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			apply(pathInput.GetText())
+		}
+	})
+
+	modalBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEsc:
+			closeModal()
+			return nil
+		case tcell.KeyTab, tcell.KeyBacktab:
+			if state.App.GetFocus() == pathInput && len(candidates) > 0 {
+				state.App.SetFocus(fileList)
+			} else {
+				state.App.SetFocus(pathInput)
+			}
+			return nil
+		}
+		return event
+	})
+
+	modalWidth := 64
+	// Message, list, input, error line and footer, plus the border.
+	modalHeight := 1 + listRows + 1 + 1 + 1 + 2
+
+	modalFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(modalBox, modalWidth, 0, true).
+			AddItem(nil, 0, 1, false), modalHeight, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	state.Pages.AddPage("move-modal", modalFlex, true, true)
+	if len(candidates) > 0 {
+		state.App.SetFocus(fileList)
+	} else {
+		state.App.SetFocus(pathInput)
+	}
+}
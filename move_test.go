@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestPlaceMovedBlock(t *testing.T) {
+	raw := []string{"Host web", "    User deploy"}
+	web := HostEntry{Kind: BlockHost, Patterns: []string{"web"}}
+	tests := []struct {
+		name  string
+		entry HostEntry
+		text  string
+		want  string
+	}{
+		{
+			name:  "before Host *",
+			entry: web,
+			text:  "Host a\n    User x\n\nHost *\n    User root\n",
+			want:  "Host a\n    User x\n\nHost web\n    User deploy\n\nHost *\n    User root\n",
+		},
+		{
+			name:  "before a Match block",
+			entry: web,
+			text:  "Host a\n\nMatch user root\n    Port 2222\n",
+			want:  "Host a\n\nHost web\n    User deploy\n\nMatch user root\n    Port 2222\n",
+		},
+		{
+			name:  "after wildcards that don't apply",
+			entry: web,
+			text:  "Host *.prod\n    User ops\n",
+			want:  "Host *.prod\n    User ops\n\nHost web\n    User deploy\n",
+		},
+		{
+			name:  "negated pattern",
+			entry: web,
+			text:  "Host * !web\n    User ops\n",
+			want:  "Host * !web\n    User ops\n\nHost web\n    User deploy\n",
+		},
+		{
+			name:  "wildcard host is appended",
+			entry: HostEntry{Kind: BlockHost, Patterns: []string{"*.dev"}},
+			text:  "Host *\n    User root\n",
+			want:  "Host *\n    User root\n\nHost web\n    User deploy\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			header, err := placeMovedBlock(doc, tt.entry, raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+			if doc.Lines[header-1].Raw != raw[0] {
+				t.Errorf("header line %d is %q", header, doc.Lines[header-1].Raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The search box understands a small query language:
+//
+//	db prod                 fuzzy words, all of which must match
+//	user:root port:2222     field prefixes (any ssh_config keyword works too)
+//	-host:legacy*           negation; * and ? in a field value are globs
+//	"primary db"            quoted phrases match literally
+//	/^db-\d+$/              regular expressions, case-insensitive, one word
+//	web OR (db -user:root)  OR (or |) between groups, parentheses to nest
+//
+// Fields other than port and tag match when the value contains the text;
+// port and tag must match exactly. Phrases and regexps without a field try
+// the alias, every option value and the tags, owner and note.
+
+// queryFields are the field prefixes besides ssh_config keywords, with the
+// values they read from an entry.
+var queryFields = map[string]func(entry HostEntry) []string{
+	"alias":    func(e HostEntry) []string { return e.Patterns },
+	"host":     func(e HostEntry) []string { return e.Patterns },
+	"hostname": func(e HostEntry) []string { return []string{e.HostName} },
+	"user":     func(e HostEntry) []string { return []string{e.User} },
+	"port":     func(e HostEntry) []string { return []string{e.Port} },
+	"file":     func(e HostEntry) []string { return []string{e.SourcePath} },
+	"jump":     func(e HostEntry) []string { return e.OptionValues("ProxyJump") },
+	"identity": func(e HostEntry) []string { return e.OptionValues("IdentityFile") },
+	"match":    func(e HostEntry) []string { return []string{e.CriteriaText()} },
+	"tag":      func(e HostEntry) []string { return e.Meta.Tags },
+	"tags":     func(e HostEntry) []string { return e.Meta.Tags },
+	"owner":    func(e HostEntry) []string { return []string{e.Meta.Owner} },
+	"note":     func(e HostEntry) []string { return []string{e.Meta.Note} },
+}
+
+// hostQuery is a parsed search query. Fuzzy holds the bare words that rank
+// and highlight results; negated words are left out.
+type hostQuery struct {
+	root  queryNode
+	Fuzzy []string
+}
+
+type queryNode interface {
+	match(entry HostEntry) bool
+}
+
+type queryAnd []queryNode
+
+func (q queryAnd) match(entry HostEntry) bool {
+	for _, node := range q {
+		if !node.match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+type queryOr []queryNode
+
+func (q queryOr) match(entry HostEntry) bool {
+	for _, node := range q {
+		if node.match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryNot struct{ node queryNode }
+
+func (q queryNot) match(entry HostEntry) bool {
+	return !q.node.match(entry)
+}
+
+// queryTerm is one word of a query, optionally scoped to a field.
+type queryTerm struct {
+	field  string
+	text   string
+	phrase bool
+	re     *regexp.Regexp
+}
+
+func (t queryTerm) match(entry HostEntry) bool {
+	if t.field == "" {
+		if t.re == nil && !t.phrase {
+			_, ok := hostScore(entry, []string{t.text})
+			return ok
+		}
+	}
+	values := []string{}
+	if t.field == "" {
+		values = append(append(values, entry.Patterns...), entry.CriteriaText())
+		for _, opt := range entry.Options {
+			values = append(values, opt.Value)
+		}
+		values = append(append(values, entry.Meta.Tags...), entry.Meta.Owner, entry.Meta.Note)
+	} else if read, ok := queryFields[t.field]; ok {
+		values = read(entry)
+	} else {
+		values = entry.OptionValues(t.field)
+	}
+	for _, value := range values {
+		if value != "" && t.matchValue(strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t queryTerm) matchValue(value string) bool {
+	switch {
+	case t.re != nil:
+		return t.re.MatchString(value)
+	case t.phrase:
+		return strings.Contains(value, t.text)
+	case t.field == "port" || t.field == "tag" || t.field == "tags":
+		return value == t.text
+	}
+	return strings.Contains(value, t.text)
+}
+
+// Match reports whether entry satisfies the query; an empty query matches
+// everything.
+func (q *hostQuery) Match(entry HostEntry) bool {
+	return q == nil || q.root == nil || q.root.match(entry)
+}
+
+// fuzzyWords returns the words to rank and highlight by.
+func (q *hostQuery) fuzzyWords() []string {
+	if q == nil {
+		return nil
+	}
+	return q.Fuzzy
+}
+
+// globRegexp turns a field glob into an anchored regexp. Unlike path.Match,
+// * also matches "/", so file:*work* finds paths.
+func globRegexp(glob string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(glob)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("(?i)^" + quoted + "$")
+}
+
+type queryToken struct {
+	kind byte // 't' term, '(', ')', '|' for OR, '-' for "-("
+	term queryTerm
+	neg  bool
+}
+
+// parseHostQuery parses a search box query.
+func parseHostQuery(input string) (*hostQuery, error) {
+	tokens, err := tokenizeQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q := &hostQuery{}
+	p.fuzzy = &q.Fuzzy
+	if len(tokens) == 0 {
+		return q, nil
+	}
+	root, err := p.parseOr(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected )")
+	}
+	q.root = root
+	return q, nil
+}
+
+func tokenizeQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	tokens := []queryToken{}
+	isSpace := func(i int) bool { return i >= len(runes) || unicode.IsSpace(runes[i]) }
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(' || r == ')' || r == '|':
+			tokens = append(tokens, queryToken{kind: byte(r)})
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '(':
+			tokens = append(tokens, queryToken{kind: '-'})
+			i += 2
+			continue
+		case r == 'O' && i+1 < len(runes) && runes[i+1] == 'R' && isSpace(i+2) && (i == 0 || unicode.IsSpace(runes[i-1])):
+			tokens = append(tokens, queryToken{kind: '|'})
+			i += 2
+			continue
+		}
+
+		token := queryToken{kind: 't'}
+		if r == '-' && !isSpace(i+1) {
+			token.neg = true
+			i++
+		}
+		// A field prefix is a known field or keyword followed by ":". Any
+		// other word with a colon, such as an IPv6 address or a URL, is
+		// matched fuzzily like the rest.
+		start := i
+		for i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '_') {
+			i++
+		}
+		field := strings.ToLower(string(runes[start:i]))
+		if i > start && i < len(runes) && runes[i] == ':' && isQueryField(field) {
+			token.term.field = field
+			i++
+			if isSpace(i) || runes[i] == ')' {
+				return nil, fmt.Errorf("%s: needs a value", field)
+			}
+		} else {
+			i = start
+		}
+
+		switch runes[i] {
+		case '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("missing closing \"")
+			}
+			token.term.text = strings.ToLower(string(runes[i+1 : end]))
+			token.term.phrase = true
+			i = end + 1
+		case '/':
+			// /regex/ is one word and may contain ")"; a word with more
+			// slashes is a path
+			end := i + 1
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			word := strings.TrimRight(string(runes[i:end]), ")")
+			if len(word) > 2 && strings.HasSuffix(word, "/") && !strings.HasSuffix(word, `\/`) {
+				pattern := word[1 : len(word)-1]
+				re, err := regexp.Compile("(?i)" + pattern)
+				if err != nil {
+					return nil, fmt.Errorf("bad regex: %v", strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+				}
+				token.term.text = pattern
+				token.term.re = re
+				i += len([]rune(word))
+				break
+			}
+			if !strings.Contains(word[1:], "/") {
+				return nil, fmt.Errorf("missing closing / in regex")
+			}
+			token.term.text = strings.ToLower(word)
+			i += len([]rune(word))
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != ')' {
+				i++
+			}
+			token.term.text = strings.ToLower(string(runes[start:i]))
+			if token.term.field != "" && strings.ContainsAny(token.term.text, "*?") {
+				token.term.re = globRegexp(token.term.text)
+			}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// isQueryField reports whether name can prefix a term: a field of its own
+// or any ssh_config keyword.
+func isQueryField(name string) bool {
+	if _, ok := queryFields[name]; ok {
+		return true
+	}
+	_, ok := sshKeywordIndex[name]
+	return ok
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	fuzzy  *[]string
+}
+
+// parseOr reads groups separated by OR up to the end or a closing ")".
+func (p *queryParser) parseOr(negated bool) (queryNode, error) {
+	groups := queryOr{}
+	for {
+		group, err := p.parseAnd(negated)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == '|' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	if len(groups) == 1 {
+		return groups[0], nil
+	}
+	return groups, nil
+}
+
+func (p *queryParser) parseAnd(negated bool) (queryNode, error) {
+	nodes := queryAnd{}
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		if token.kind == '|' || token.kind == ')' {
+			break
+		}
+		p.pos++
+		switch token.kind {
+		case '(', '-':
+			inner, err := p.parseOr(negated != (token.kind == '-'))
+			if err != nil {
+				return nil, err
+			}
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != ')' {
+				return nil, fmt.Errorf("missing )")
+			}
+			p.pos++
+			if token.kind == '-' {
+				inner = queryNot{inner}
+			}
+			nodes = append(nodes, inner)
+		default:
+			var node queryNode = token.term
+			if token.neg {
+				node = queryNot{node}
+			}
+			if token.term.field == "" && token.term.re == nil && !token.term.phrase && token.neg == negated {
+				*p.fuzzy = append(*p.fuzzy, token.term.text)
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		if p.pos < len(p.tokens) && p.tokens[p.pos].kind == '|' || p.pos > 0 && p.tokens[p.pos-1].kind == '|' {
+			return nil, fmt.Errorf("OR needs a term on each side")
+		}
+		return nil, fmt.Errorf("empty ( )")
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const queryTestConfig = `# 55h: tags=prod,web
+Host web-1
+    HostName web1.prod.example.com
+    User root
+
+# 55h: tags=staging
+Host web-2
+    HostName web2.staging.example.com
+    User deploy
+    Port 2222
+
+# 55h: tags=prod,db note="primary db"
+Host db-1
+    HostName db1.prod.example.com
+    User postgres
+    ProxyJump bastion
+
+Host bastion
+    HostName bastion.example.com
+    User root
+`
+
+func loadQueryTestEntries(t *testing.T) []HostEntry {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(queryTestConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := loadSSHConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestHostQueryMatch(t *testing.T) {
+	entries := loadQueryTestEntries(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"web-1", "web-2", "db-1", "bastion"}},
+		{"web", []string{"web-1", "web-2"}},
+		{"user:root", []string{"web-1", "bastion"}},
+		{"USER:ROOT", []string{"web-1", "bastion"}},
+		{"-user:root", []string{"web-2", "db-1"}},
+		{"port:2222", []string{"web-2"}},
+		{"port:22", nil},
+		{"tag:prod", []string{"web-1", "db-1"}},
+		{"tag:pro", nil},
+		{"hostname:*.prod.*", []string{"web-1", "db-1"}},
+		{"jump:bastion", []string{"db-1"}},
+		{"note:primary", []string{"db-1"}},
+		{`"primary db"`, []string{"db-1"}},
+		{`/^web-\d$/`, []string{"web-1", "web-2"}},
+		{"/STAGING/", []string{"web-2"}},
+
+		// AND binds tighter than OR.
+		{"user:root web OR tag:db", []string{"web-1", "db-1"}},
+		{"tag:db OR user:root web", []string{"web-1", "db-1"}},
+		{"user:root (web OR tag:db)", []string{"web-1"}},
+		{"alias:bastion | user:deploy", []string{"web-2", "bastion"}},
+		{"((tag:staging))", []string{"web-2"}},
+		{"(tag:prod (user:postgres OR user:deploy)) OR alias:bastion", []string{"db-1", "bastion"}},
+		{"-(tag:prod)", []string{"web-2", "bastion"}},
+		{"-(user:root OR tag:db)", []string{"web-2"}},
+		{"-(-tag:prod)", []string{"web-1", "db-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseHostQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseHostQuery(%q): %v", tt.query, err)
+			}
+			var got []string
+			for _, entry := range entries {
+				if q.Match(entry) {
+					got = append(got, entry.Patterns[0])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostQueryFuzzyWords(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"db prod", []string{"db", "prod"}},
+		{"web -db user:root", []string{"web"}},
+		{`web "primary db" /^db/`, []string{"web"}},
+		{"web (x OR y)", []string{"web", "x", "y"}},
+		{"-(a b)", nil},
+		{"-(a -b)", []string{"b"}},
+		{"nosuchfield:x", []string{"nosuchfield:x"}},
+		{"fe80::1 http://intra db:", []string{"fe80::1", "http://intra", "db:"}},
+	}
+	for _, tt := range tests {
+		q, err := parseHostQuery(tt.query)
+		if err != nil {
+			t.Fatalf("parseHostQuery(%q): %v", tt.query, err)
+		}
+		if got := q.fuzzyWords(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHostQuery(%q).Fuzzy = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestHostQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"(web", "missing )"},
+		{"((web) OR db", "missing )"},
+		{"web)", "unexpected )"},
+		{"(web))", "unexpected )"},
+		{"()", "empty ( )"},
+		{"OR web", "OR needs a term on each side"},
+		{"web OR", "OR needs a term on each side"},
+		{"web | | db", "OR needs a term on each side"},
+		{"/[a/", "bad regex"},
+		{"/abc", "missing closing / in regex"},
+		{`"primary db`, `missing closing "`},
+		{"user:", "user: needs a value"},
+	}
+	for _, tt := range tests {
+		_, err := parseHostQuery(tt.query)
+		if err == nil {
+			t.Errorf("parseHostQuery(%q) succeeded, want error %q", tt.query, tt.want)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseHostQuery(%q) error = %q, want %q", tt.query, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EffectiveOption is the value ssh ends up using for an option, together with
+// the directive it was taken from.
+type EffectiveOption struct {
+	Key        string
+	Value      string
+	SourcePath string
+	Line       int
+}
+
+// EffectiveConfig is the result of applying every matching block to an alias.
+type EffectiveConfig struct {
+	Alias   string
+	Options []EffectiveOption
+	// Notes explains blocks that could not be evaluated, such as Match exec.
+	Notes []string
+}
+
+// Get returns the effective value of a single-valued option.
+func (cfg EffectiveConfig) Get(key string) (EffectiveOption, bool) {
+	for _, opt := range cfg.Options {
+		if strings.EqualFold(opt.Key, key) {
+			return opt, true
+		}
+	}
+	return EffectiveOption{}, false
+}
+
+// Values returns every effective occurrence of an option, in order.
+func (cfg EffectiveConfig) Values(key string) []EffectiveOption {
+	values := []EffectiveOption{}
+	for _, opt := range cfg.Options {
+		if strings.EqualFold(opt.Key, key) {
+			values = append(values, opt)
+		}
+	}
+	return values
+}
+
+// resolveEffectiveConfig walks blocks (as returned by loadSSHConfigBlocks) the
+// way ssh does for "ssh alias": every global, matching Host and matching Match
+// block contributes, and for ordinary options the first obtained value wins.
+// Headers and directives are taken in reading order rather than block by
+// block, since the directives after an Include inside a block are read after
+// the included files.
+func resolveEffectiveConfig(blocks []HostEntry, alias string) EffectiveConfig {
+	cfg := EffectiveConfig{Alias: alias}
+	seen := map[string]bool{}
+
+	// A step is a block header (option -1) or one of its directives.
+	type step struct{ block, option, seq int }
+	steps := []step{}
+	for i, block := range blocks {
+		steps = append(steps, step{i, -1, block.Seq})
+		for j, opt := range block.Options {
+			steps = append(steps, step{i, j, opt.Seq})
+		}
+	}
+	sort.SliceStable(steps, func(a, b int) bool {
+		return steps[a].seq < steps[b].seq
+	})
+
+	active := make([]bool, len(blocks))
+	// matched records the Host and Match blocks that applied, for the
+	// blocks their Include lines read.
+	matched := map[string]bool{}
+	for _, s := range steps {
+		block := blocks[s.block]
+		if s.option < 0 {
+			applies := block.Within == nil || matched[blockKey(*block.Within)]
+			switch {
+			case !applies:
+			case block.Kind == BlockHost:
+				applies = hostPatternsMatch(block.Patterns, alias)
+			case block.Kind == BlockMatch:
+				ok, note := cfg.matchCriteria(block)
+				if note != "" {
+					cfg.Notes = append(cfg.Notes, note)
+				}
+				applies = ok
+			}
+			active[s.block] = applies
+			if block.Kind != BlockGlobal {
+				matched[blockKey(block)] = applies
+			}
+			continue
+		}
+		if !active[s.block] {
+			continue
+		}
+
+		opt := block.Options[s.option]
+		key := strings.ToLower(opt.Key)
+		if !multiValueKeywords[key] {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		value := opt.Value
+		if key == "hostname" {
+			value = strings.ReplaceAll(value, "%h", alias)
+		}
+		cfg.Options = append(cfg.Options, EffectiveOption{
+			Key:        opt.Key,
+			Value:      value,
+			SourcePath: opt.SourcePath,
+			Line:       opt.Line,
+		})
+	}
+
+	return cfg
+}
+
+func blockKey(block HostEntry) string {
+	return fmt.Sprintf("%s:%d", block.SourcePath, block.StartLine)
+}
+
+// matchCriteria evaluates a Match block against what has been resolved so far.
+// Criteria that need to run commands or inspect the network are not
+// evaluated; the block is treated as not matching and a note is returned.
+func (cfg EffectiveConfig) matchCriteria(block HostEntry) (bool, string) {
+	targetHost := cfg.Alias
+	if opt, ok := cfg.Get("HostName"); ok {
+		targetHost = opt.Value
+	}
+	targetUser := localUserName()
+	if opt, ok := cfg.Get("User"); ok {
+		targetUser = opt.Value
+	}
+	tag := ""
+	if opt, ok := cfg.Get("Tag"); ok {
+		tag = opt.Value
+	}
+
+	for _, c := range block.Criteria {
+		var result bool
+		switch c.Keyword {
+		case "all", "final":
+			// 55h shows the final pass, where "final" blocks also apply.
+			result = true
+		case "canonical":
+			result = false
+		case "host":
+			result = patternListMatch(c.Value, targetHost)
+		case "originalhost":
+			result = patternListMatch(c.Value, cfg.Alias)
+		case "user":
+			result = patternListMatch(c.Value, targetUser)
+		case "localuser":
+			result = patternListMatch(c.Value, localUserName())
+		case "tagged":
+			result = patternListMatch(c.Value, tag)
+		default:
+			return false, fmt.Sprintf("Match %s at %s:%d not evaluated", c.Keyword, filepath.Base(block.SourcePath), block.StartLine)
+		}
+		if c.Negated {
+			result = !result
+		}
+		if !result {
+			return false, ""
+		}
+	}
+	return true, ""
+}
+
+// hostPatternsMatch applies the Host line rules: at least one pattern must
+// match and no negated pattern may match.
+func hostPatternsMatch(patterns []string, host string) bool {
+	matched := false
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			if wildcardMatch(p[1:], host) {
+				return false
+			}
+			continue
+		}
+		if wildcardMatch(p, host) {
+			matched = true
+		}
+	}
+	return matched
+}
+
+// patternListMatch applies hostPatternsMatch to a comma-separated list, as
+// used by Match criteria.
+func patternListMatch(list string, value string) bool {
+	return hostPatternsMatch(strings.Split(list, ","), value)
+}
+
+// wildcardMatch reports whether s matches pattern, where '*' matches any run
+// of characters and '?' exactly one. Matching is case-insensitive like ssh.
+func wildcardMatch(pattern string, s string) bool {
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(s))
+	pi, ti := 0, 0
+	star, mark := -1, 0
+	for ti < len(t) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == t[ti]):
+			pi++
+			ti++
+		case pi < len(p) && p[pi] == '*':
+			star = pi
+			mark = ti
+			pi++
+		case star != -1:
+			pi = star + 1
+			mark++
+			ti = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func localUserName() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveEffectiveConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		// files maps a name below the config directory to its text; "config"
+		// is the main config.
+		files map[string]string
+		alias string
+		want  []string
+		notes int
+	}{
+		{
+			name:  "first value wins",
+			files: map[string]string{"config": "Host web\n    User deploy\n\nHost *\n    User root\n    Port 2222\n"},
+			alias: "web",
+			want:  []string{"User deploy", "Port 2222"},
+		},
+		{
+			name:  "options before the first Host",
+			files: map[string]string{"config": "User global\n\nHost web\n    User deploy\n    Port 22\n"},
+			alias: "web",
+			want:  []string{"User global", "Port 22"},
+		},
+		{
+			name:  "negated pattern excludes the alias",
+			files: map[string]string{"config": "Host * !web\n    User ops\n\nHost *\n    User root\n"},
+			alias: "web",
+			want:  []string{"User root"},
+		},
+		{
+			name:  "negated pattern other alias",
+			files: map[string]string{"config": "Host * !web\n    User ops\n\nHost *\n    User root\n"},
+			alias: "db",
+			want:  []string{"User ops"},
+		},
+		{
+			name:  "wildcards ignore case",
+			files: map[string]string{"config": "Host WEB-?\n    User deploy\n"},
+			alias: "web-1",
+			want:  []string{"User deploy"},
+		},
+		{
+			name:  "HostName expands %h",
+			files: map[string]string{"config": "Host *\n    HostName %h.example.com\n"},
+			alias: "web",
+			want:  []string{"HostName web.example.com"},
+		},
+		{
+			name:  "IdentityFile accumulates",
+			files: map[string]string{"config": "Host web\n    IdentityFile ~/.ssh/web\n\nHost *\n    IdentityFile ~/.ssh/default\n"},
+			alias: "web",
+			want:  []string{"IdentityFile ~/.ssh/web", "IdentityFile ~/.ssh/default"},
+		},
+		{
+			name: "Include inside a Host block applies only to it",
+			files: map[string]string{
+				"config":   "Host web\n    Include web.conf\n\nHost db\n    Include db.conf\n",
+				"web.conf": "User w\n",
+				"db.conf":  "User d\n",
+			},
+			alias: "db",
+			want:  []string{"User d"},
+		},
+		{
+			name: "directives after an Include are read after the included file",
+			files: map[string]string{
+				"config":   "Host web\n    Include inc.conf\n    User late\n",
+				"inc.conf": "User early\nPort 2222\n",
+			},
+			alias: "web",
+			want:  []string{"User early", "Port 2222"},
+		},
+		{
+			name: "top-level Include keeps reading order",
+			files: map[string]string{
+				"config":     "Include conf.d/*\n\nHost *\n    User root\n",
+				"conf.d/web": "Host web\n    User deploy\n",
+			},
+			alias: "web",
+			want:  []string{"User deploy"},
+		},
+		{
+			name:  "Match host sees the resolved HostName",
+			files: map[string]string{"config": "Host web\n    HostName web.example.com\n\nMatch host *.example.com\n    User ex\n"},
+			alias: "web",
+			want:  []string{"HostName web.example.com", "User ex"},
+		},
+		{
+			name:  "Match originalhost and user",
+			files: map[string]string{"config": "Host web\n    User deploy\n\nMatch originalhost web user deploy\n    Port 2222\n"},
+			alias: "web",
+			want:  []string{"User deploy", "Port 2222"},
+		},
+		{
+			name:  "negated Match criterion",
+			files: map[string]string{"config": "Match !host web\n    User other\n\nMatch all\n    User root\n"},
+			alias: "web",
+			want:  []string{"User root"},
+		},
+		{
+			name:  "Match exec is not evaluated",
+			files: map[string]string{"config": "Match exec \"true\"\n    User exec\n\nHost *\n    User root\n"},
+			alias: "web",
+			want:  []string{"User root"},
+			notes: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, text := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(text), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			blocks, err := loadSSHConfigBlocks(filepath.Join(dir, "config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := resolveEffectiveConfig(blocks, tt.alias)
+			got := []string{}
+			for _, opt := range cfg.Options {
+				got = append(got, opt.Key+" "+opt.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("options = %q, want %q", got, tt.want)
+			}
+			if len(cfg.Notes) != tt.notes {
+				t.Errorf("notes = %q, want %d", cfg.Notes, tt.notes)
+			}
+		})
+	}
+}
+
+func TestResolveEffectiveConfigSource(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte("Host web\n    User deploy\n\nHost *\n    User root\n    Port 2222\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := loadSSHConfigBlocks(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := resolveEffectiveConfig(blocks, "web")
+	for key, line := range map[string]int{"User": 2, "Port": 6} {
+		opt, ok := cfg.Get(key)
+		if !ok || opt.SourcePath != path || opt.Line != line {
+			t.Errorf("%s comes from %s:%d, want line %d", key, opt.SourcePath, opt.Line, line)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ConfigLine is one physical line of an ssh config file. Raw always holds the
+// exact text (without the line ending), so unmodified lines are written back
+// byte-for-byte; the other fields are a parsed view of Raw.
+type ConfigLine struct {
+	Raw    string
+	Ending string // "\n", "\r\n" or "" for a last line without newline
+
+	Indent    string
+	Key       string // keyword as written; empty for blank and comment lines
+	Separator string // text between key and value: " ", "=", " = ", "\t", ...
+	Value     string
+	Trailing  string // trailing whitespace and "# comment" after the value
+}
+
+// IsDirective reports whether the line carries a keyword.
+func (line *ConfigLine) IsDirective() bool {
+	return line.Key != ""
+}
+
+// IsBlank reports whether the line is empty or whitespace only.
+func (line *ConfigLine) IsBlank() bool {
+	return strings.TrimSpace(line.Raw) == ""
+}
+
+// IsComment reports whether the line is a full-line comment.
+func (line *ConfigLine) IsComment() bool {
+	return strings.HasPrefix(strings.TrimSpace(line.Raw), "#")
+}
+
+// Keyword returns the lowercased keyword.
+func (line *ConfigLine) Keyword() string {
+	return strings.ToLower(line.Key)
+}
+
+// setValue replaces the value while keeping indentation, separator style and
+// any trailing comment.
+func (line *ConfigLine) setValue(value string) {
+	line.Value = value
+	if line.Separator == "" {
+		line.Separator = " "
+	}
+	line.Raw = line.Indent + line.Key + line.Separator + line.Value + line.Trailing
+}
+
+func parseConfigLine(raw string) *ConfigLine {
+	line := &ConfigLine{Raw: raw}
+	trimmed := strings.TrimLeft(raw, " \t")
+	line.Indent = raw[:len(raw)-len(trimmed)]
+	if strings.TrimSpace(trimmed) == "" || strings.HasPrefix(trimmed, "#") {
+		return line
+	}
+
+	end := strings.IndexAny(trimmed, " \t=")
+	if end == -1 {
+		line.Key = trimmed
+		return line
+	}
+	line.Key = trimmed[:end]
+	rest := trimmed[end:]
+
+	// Separator: whitespace, at most one '=', whitespace.
+	i := 0
+	for i < len(rest) && (rest[i] == ' ' || rest[i] == '\t') {
+		i++
+	}
+	if i < len(rest) && rest[i] == '=' {
+		i++
+		for i < len(rest) && (rest[i] == ' ' || rest[i] == '\t') {
+			i++
+		}
+	}
+	line.Separator = rest[:i]
+	rest = rest[i:]
+
+	valueEnd := trailingCommentStart(rest)
+	line.Value = rest[:valueEnd]
+	line.Trailing = rest[valueEnd:]
+	return line
+}
+
+// trailingCommentStart returns where the value ends: before trailing
+// whitespace, and before a '#' that starts a new argument outside quotes.
+func trailingCommentStart(rest string) int {
+	inQuotes := false
+	for i := 0; i < len(rest); i++ {
+		switch c := rest[i]; {
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == '#' && !inQuotes && i > 0 && (rest[i-1] == ' ' || rest[i-1] == '\t'):
+			return len(strings.TrimRight(rest[:i], " \t"))
+		}
+	}
+	return len(strings.TrimRight(rest, " \t"))
+}
+
+// DocBlock locates a block inside a ConfigDocument by line index.
+type DocBlock struct {
+	Kind BlockKind
+	// Header is the index of the Host/Match line, or -1 for the global block.
+	Header int
+	// Start is the first line of the block: Header, or the first directive of
+	// a global block.
+	Start int
+	// End is the index of the last directive belonging to the block.
+	End      int
+	Patterns []string
+}
+
+// ConfigDocument is a lossless model of a single ssh config file. All edits
+// made by 55h go through it so comments, blank lines and formatting of
+// untouched lines survive.
+type ConfigDocument struct {
+	Path    string
+	Lines   []*ConfigLine
+	Newline string
+}
+
+// parseConfigDocument reads path into a document. A missing file yields an
+// empty document so callers can create it by saving.
+func parseConfigDocument(path string) (*ConfigDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &ConfigDocument{Path: path, Newline: "\n"}, nil
+		}
+		return nil, err
+	}
+	return parseConfigDocumentBytes(path, data), nil
+}
+
+func parseConfigDocumentBytes(path string, data []byte) *ConfigDocument {
+	doc := &ConfigDocument{Path: path, Newline: "\n"}
+	text := string(data)
+	for len(text) > 0 {
+		idx := strings.IndexByte(text, '\n')
+		raw, ending := text, ""
+		if idx >= 0 {
+			raw, ending = text[:idx], "\n"
+			text = text[idx+1:]
+		} else {
+			text = ""
+		}
+		if strings.HasSuffix(raw, "\r") && ending != "" {
+			raw, ending = raw[:len(raw)-1], "\r\n"
+		}
+		if len(doc.Lines) == 0 && ending == "\r\n" {
+			doc.Newline = "\r\n"
+		}
+		line := parseConfigLine(raw)
+		line.Ending = ending
+		doc.Lines = append(doc.Lines, line)
+	}
+	return doc
+}
+
+// Bytes serialises the document.
+func (doc *ConfigDocument) Bytes() []byte {
+	var sb strings.Builder
+	for _, line := range doc.Lines {
+		sb.WriteString(line.Raw)
+		sb.WriteString(line.Ending)
+	}
+	return []byte(sb.String())
+}
+
+// Save writes the document back to its path as one undoable operation.
+// reason describes the change in the backup and the undo history.
+func (doc *ConfigDocument) Save(reason string) error {
+	return saveDocuments(reason, doc)
+}
+
+// Blocks indexes the Host, Match and global blocks of the document.
+func (doc *ConfigDocument) Blocks() []DocBlock {
+	blocks := []DocBlock{}
+	var current *DocBlock
+	for i, line := range doc.Lines {
+		if !line.IsDirective() {
+			continue
+		}
+		switch line.Keyword() {
+		case "host", "match":
+			if current != nil {
+				blocks = append(blocks, *current)
+			}
+			kind := BlockHost
+			patterns := splitArgs(line.Value)
+			if line.Keyword() == "match" {
+				kind = BlockMatch
+				patterns = []string{}
+			}
+			current = &DocBlock{Kind: kind, Header: i, Start: i, End: i, Patterns: patterns}
+		default:
+			if current == nil {
+				current = &DocBlock{Kind: BlockGlobal, Header: -1, Start: i, End: i, Patterns: []string{}}
+			}
+			current.End = i
+		}
+	}
+	if current != nil {
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// FindBlock returns the block whose Host/Match line is at lineNo (1-based,
+// as recorded in HostEntry.StartLine).
+func (doc *ConfigDocument) FindBlock(lineNo int) (DocBlock, error) {
+	for _, block := range doc.Blocks() {
+		if block.Header >= 0 && block.Header == lineNo-1 {
+			return block, nil
+		}
+	}
+	return DocBlock{}, fmt.Errorf("no Host or Match block at %s:%d", doc.Path, lineNo)
+}
+
+// LeadingComments returns the index of the first comment line directly above
+// the block header (no blank line in between), or Start if there is none.
+func (doc *ConfigDocument) LeadingComments(block DocBlock) int {
+	first := block.Start
+	for first > 0 && doc.Lines[first-1].IsComment() {
+		first--
+	}
+	return first
+}
+
+// metaSpan widens the block to the metadata comments that belong to it:
+// those directly above the header, and those after its last directive that
+// a blank line or the end of the file separates from the next block.
+func (doc *ConfigDocument) metaSpan(block DocBlock) (int, int) {
+	from, to := block.Start, block.End
+	for from > 0 && isMetaComment(doc.Lines[from-1].Raw) {
+		from--
+	}
+	end := to
+	for end+1 < len(doc.Lines) && isMetaComment(doc.Lines[end+1].Raw) {
+		end++
+	}
+	if end+1 == len(doc.Lines) || doc.Lines[end+1].IsBlank() {
+		to = end
+	}
+	return from, to
+}
+
+// blockIndent returns the indentation and separator used by the block's
+// directives, falling back to the document's style and then to the 55h default.
+func (doc *ConfigDocument) blockIndent(block *DocBlock) (string, string) {
+	if block != nil && block.Header >= 0 {
+		for i := block.Header + 1; i <= block.End; i++ {
+			if doc.Lines[i].IsDirective() {
+				return doc.Lines[i].Indent, doc.Lines[i].Separator
+			}
+		}
+	}
+	for _, b := range doc.Blocks() {
+		if b.Header < 0 {
+			continue
+		}
+		for i := b.Header + 1; i <= b.End; i++ {
+			if doc.Lines[i].IsDirective() && doc.Lines[i].Indent != "" {
+				return doc.Lines[i].Indent, doc.Lines[i].Separator
+			}
+		}
+	}
+	return "    ", " "
+}
+
+func (doc *ConfigDocument) newLine(raw string) *ConfigLine {
+	line := parseConfigLine(raw)
+	line.Ending = doc.Newline
+	return line
+}
+
+func (doc *ConfigDocument) insertLines(at int, lines ...*ConfigLine) {
+	if at > 0 && at == len(doc.Lines) && doc.Lines[at-1].Ending == "" {
+		doc.Lines[at-1].Ending = doc.Newline
+	}
+	doc.Lines = append(doc.Lines[:at], append(lines, doc.Lines[at:]...)...)
+}
+
+func (doc *ConfigDocument) removeLines(from, to int) {
+	doc.Lines = append(doc.Lines[:from], doc.Lines[to+1:]...)
+}
+
+// blockLines renders a new Host block in the document's style.
+func (doc *ConfigDocument) blockLines(patterns []string, options [][2]string) []*ConfigLine {
+	indent, sep := doc.blockIndent(nil)
+	lines := []*ConfigLine{doc.newLine("Host " + strings.Join(patterns, " "))}
+	for _, opt := range options {
+		lines = append(lines, doc.newLine(indent+opt[0]+sep+opt[1]))
+	}
+	return lines
+}
+
+// AddHostBlock appends a Host block, separated from existing content by a
+// blank line, and returns its header line number.
+func (doc *ConfigDocument) AddHostBlock(patterns []string, options [][2]string) int {
+	return doc.appendBlock(doc.blockLines(patterns, options))
+}
+
+// AppendBlock appends raw lines, such as a block cut from another file, and
+// returns the line number of their Host or Match header.
+func (doc *ConfigDocument) AppendBlock(raw []string) int {
+	return doc.appendBlock(doc.newLines(raw))
+}
+
+func (doc *ConfigDocument) newLines(raw []string) []*ConfigLine {
+	lines := make([]*ConfigLine, len(raw))
+	for i, r := range raw {
+		lines[i] = doc.newLine(r)
+	}
+	return lines
+}
+
+func (doc *ConfigDocument) appendBlock(lines []*ConfigLine) int {
+	if len(doc.Lines) > 0 && !doc.Lines[len(doc.Lines)-1].IsBlank() {
+		lines = append([]*ConfigLine{doc.newLine("")}, lines...)
+	}
+	return doc.insertBlock(len(doc.Lines), lines)
+}
+
+// InsertBlockAfter places lines right after the block whose header is at
+// lineNo and its metadata comments, separated by blank lines, and returns
+// the line number of their Host header.
+func (doc *ConfigDocument) InsertBlockAfter(lineNo int, lines []*ConfigLine) (int, error) {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return 0, err
+	}
+	_, to := doc.metaSpan(block)
+	at := to + 1
+	if at == len(doc.Lines) {
+		return doc.appendBlock(lines), nil
+	}
+	lines = append([]*ConfigLine{doc.newLine("")}, lines...)
+	if !doc.Lines[at].IsBlank() {
+		lines = append(lines, doc.newLine(""))
+	}
+	return doc.insertBlock(at, lines), nil
+}
+
+// InsertBlockBefore places lines above the block whose header is at lineNo
+// and the comments that travel with it, separated by blank lines, and
+// returns the line number of their Host or Match header.
+func (doc *ConfigDocument) InsertBlockBefore(lineNo int, lines []*ConfigLine) (int, error) {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return 0, err
+	}
+	at, _ := doc.blockSpan(block)
+	lines = append(lines, doc.newLine(""))
+	if at > 0 && !doc.Lines[at-1].IsBlank() {
+		lines = append([]*ConfigLine{doc.newLine("")}, lines...)
+	}
+	return doc.insertBlock(at, lines), nil
+}
+
+func (doc *ConfigDocument) insertBlock(at int, lines []*ConfigLine) int {
+	doc.insertLines(at, lines...)
+	for i, line := range lines {
+		if line.IsDirective() && (line.Keyword() == "host" || line.Keyword() == "match") {
+			return at + i + 1
+		}
+	}
+	return at + 1
+}
+
+// blockSpan is what travels with a block when it moves: the comments
+// directly above its header and its metadata comments.
+func (doc *ConfigDocument) blockSpan(block DocBlock) (int, int) {
+	from, to := doc.metaSpan(block)
+	return min(from, doc.LeadingComments(block)), to
+}
+
+// BlockText returns the raw lines of the block at lineNo with its leading
+// comments.
+func (doc *ConfigDocument) BlockText(lineNo int) ([]string, error) {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return nil, err
+	}
+	from, to := doc.blockSpan(block)
+	raw := []string{}
+	for _, line := range doc.Lines[from : to+1] {
+		raw = append(raw, line.Raw)
+	}
+	return raw, nil
+}
+
+// RemoveBlock deletes what BlockText returns: the block whose header is at
+// lineNo, the comments directly above it and its "# 55h:" metadata comments,
+// together with one of the blank lines around it so the spacing of
+// neighbours is kept. Delete and move agree on what a block is this way.
+func (doc *ConfigDocument) RemoveBlock(lineNo int) error {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return err
+	}
+	doc.removeSpan(doc.blockSpan(block))
+	return nil
+}
+
+func (doc *ConfigDocument) removeSpan(from, to int) {
+	if to+1 < len(doc.Lines) && doc.Lines[to+1].IsBlank() && (from == 0 || doc.Lines[from-1].IsBlank()) {
+		to++
+	} else if to+1 == len(doc.Lines) {
+		for from > 0 && doc.Lines[from-1].IsBlank() {
+			from--
+		}
+	}
+	doc.removeLines(from, to)
+}
+
+// SetOption sets key in the block at lineNo. The first existing occurrence is
+// updated in place; otherwise a line is added after the block's last directive.
+func (doc *ConfigDocument) SetOption(lineNo int, key, value string) error {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return err
+	}
+	for i := block.Header + 1; i <= block.End; i++ {
+		if doc.Lines[i].IsDirective() && strings.EqualFold(doc.Lines[i].Key, key) {
+			doc.Lines[i].setValue(value)
+			return nil
+		}
+	}
+	indent, sep := doc.blockIndent(&block)
+	doc.insertLines(block.End+1, doc.newLine(indent+canonicalKeyword(key)+sep+value))
+	return nil
+}
+
+// AppendOptions adds directives after the last directive of the block at
+// lineNo, in the block's indentation style.
+func (doc *ConfigDocument) AppendOptions(lineNo int, options [][2]string) error {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return err
+	}
+	indent, sep := doc.blockIndent(&block)
+	lines := make([]*ConfigLine, 0, len(options))
+	for _, opt := range options {
+		lines = append(lines, doc.newLine(indent+canonicalKeyword(opt[0])+sep+opt[1]))
+	}
+	doc.insertLines(block.End+1, lines...)
+	return nil
+}
+
+// UnsetOption removes every occurrence of key from the block at lineNo and
+// reports how many lines were removed.
+func (doc *ConfigDocument) UnsetOption(lineNo int, key string) (int, error) {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for i := block.End; i > block.Header; i-- {
+		if doc.Lines[i].IsDirective() && strings.EqualFold(doc.Lines[i].Key, key) {
+			doc.removeLines(i, i)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// valueArg is one argument of a directive's value, with its byte span in
+// the raw value including any quotes. text is the argument as splitArgs
+// returns it.
+type valueArg struct {
+	text       string
+	start, end int
+}
+
+// valueArgs splits a value like splitArgs and keeps where each argument
+// came from, so one argument can be edited without requoting the others.
+func valueArgs(value string) []valueArg {
+	args := []valueArg{}
+	var current strings.Builder
+	inQuotes, start := false, -1
+	for i, r := range value {
+		if unicode.IsSpace(r) && !inQuotes {
+			if start >= 0 {
+				args = append(args, valueArg{current.String(), start, i})
+				current.Reset()
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else {
+			current.WriteRune(r)
+		}
+	}
+	if start >= 0 {
+		args = append(args, valueArg{current.String(), start, len(value)})
+	}
+	return args
+}
+
+// RenamePattern replaces one pattern on the Host line at lineNo. The other
+// patterns keep their quoting and spacing.
+func (doc *ConfigDocument) RenamePattern(lineNo int, oldPattern, newPattern string) error {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return err
+	}
+	if block.Kind != BlockHost {
+		return fmt.Errorf("%s:%d is not a Host line", doc.Path, lineNo)
+	}
+	value := doc.Lines[block.Header].Value
+	var b strings.Builder
+	last, found := 0, false
+	for _, arg := range valueArgs(value) {
+		if arg.text == oldPattern {
+			b.WriteString(value[last:arg.start])
+			b.WriteString(newPattern)
+			last, found = arg.end, true
+		}
+	}
+	if !found {
+		return fmt.Errorf("pattern %s not found at %s:%d", oldPattern, doc.Path, lineNo)
+	}
+	b.WriteString(value[last:])
+	doc.Lines[block.Header].setValue(b.String())
+	return nil
+}
+
+// RemovePattern drops one pattern from the Host line at lineNo, with the
+// space before it. The last pattern cannot be removed; remove the block
+// instead.
+func (doc *ConfigDocument) RemovePattern(lineNo int, pattern string) error {
+	block, err := doc.FindBlock(lineNo)
+	if err != nil {
+		return err
+	}
+	if block.Kind != BlockHost {
+		return fmt.Errorf("%s:%d is not a Host line", doc.Path, lineNo)
+	}
+	value := doc.Lines[block.Header].Value
+	args := valueArgs(value)
+	var b strings.Builder
+	kept := 0
+	for i, arg := range args {
+		if arg.text == pattern {
+			continue
+		}
+		if kept == 0 {
+			b.WriteString(value[:args[0].start])
+		} else {
+			b.WriteString(value[args[i-1].end:arg.start])
+		}
+		b.WriteString(value[arg.start:arg.end])
+		kept++
+	}
+	switch {
+	case kept == len(args):
+		return fmt.Errorf("pattern %s not found at %s:%d", pattern, doc.Path, lineNo)
+	case kept == 0:
+		return fmt.Errorf("%s is the only pattern at %s:%d", pattern, doc.Path, lineNo)
+	}
+	b.WriteString(value[args[len(args)-1].end:])
+	doc.Lines[block.Header].setValue(b.String())
+	return nil
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func parseTestDocument(text string) *ConfigDocument {
+	return parseConfigDocumentBytes("config", []byte(text))
+}
+
+func TestConfigDocumentRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"no final newline", "Host a\n    HostName a.example.com"},
+		{"crlf", "Host a\r\n    HostName a.example.com\r\n"},
+		{"mixed endings", "Host a\r\n\tUser root\n"},
+		{"key=value styles", "Host a\n  Port=22\n  User = root\n\tHostName\ta.example.com\n"},
+		{"comments and blanks", "# top\n\n   \nHost a # trailing\n    # inside\n    ProxyJump b # via b\n\n"},
+		{"quoted values", "Host \"a b\" c\n    IdentityFile \"~/.ssh/my key\"\n"},
+		{"global options", "Include conf.d/*\nServerAliveInterval 30\n\nHost *\n    User me\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			if got := string(doc.Bytes()); got != tt.text {
+				t.Errorf("round trip changed the text:\n got %q\nwant %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestParseConfigLine(t *testing.T) {
+	tests := []struct {
+		raw                                     string
+		indent, key, separator, value, trailing string
+	}{
+		{"Host a b", "", "Host", " ", "a b", ""},
+		{"    Port=22", "    ", "Port", "=", "22", ""},
+		{"\tUser = root  ", "\t", "User", " = ", "root", "  "},
+		{"  ProxyJump b # via b", "  ", "ProxyJump", " ", "b", " # via b"},
+		{"  LocalCommand echo \"# not a comment\"", "  ", "LocalCommand", " ", "echo \"# not a comment\"", ""},
+		{"  SetEnv A=b#c", "  ", "SetEnv", " ", "A=b#c", ""},
+		{"# comment", "", "", "", "", ""},
+		{"   ", "   ", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		line := parseConfigLine(tt.raw)
+		if line.Indent != tt.indent || line.Key != tt.key || line.Separator != tt.separator || line.Value != tt.value || line.Trailing != tt.trailing {
+			t.Errorf("parseConfigLine(%q) = {%q %q %q %q %q}, want {%q %q %q %q %q}", tt.raw,
+				line.Indent, line.Key, line.Separator, line.Value, line.Trailing,
+				tt.indent, tt.key, tt.separator, tt.value, tt.trailing)
+		}
+	}
+}
+
+const blockTestConfig = `ServerAliveInterval 30
+
+# web servers
+Host web
+    HostName web.example.com
+# 55h: owner=ops
+
+Host db
+    HostName db.example.com
+Match host *.example.com
+    User deploy
+`
+
+func TestFindBlock(t *testing.T) {
+	tests := []struct {
+		lineNo   int
+		wantErr  bool
+		kind     BlockKind
+		header   int
+		end      int
+		patterns string
+	}{
+		{lineNo: 4, kind: BlockHost, header: 3, end: 4, patterns: "web"},
+		{lineNo: 8, kind: BlockHost, header: 7, end: 8, patterns: "db"},
+		{lineNo: 10, kind: BlockMatch, header: 9, end: 10},
+		{lineNo: 1, wantErr: true},
+		{lineNo: 5, wantErr: true},
+		{lineNo: 99, wantErr: true},
+	}
+	doc := parseTestDocument(blockTestConfig)
+	for _, tt := range tests {
+		block, err := doc.FindBlock(tt.lineNo)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("FindBlock(%d) = %+v, want an error", tt.lineNo, block)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FindBlock(%d): %v", tt.lineNo, err)
+			continue
+		}
+		if block.Kind != tt.kind || block.Header != tt.header || block.End != tt.end || strings.Join(block.Patterns, " ") != tt.patterns {
+			t.Errorf("FindBlock(%d) = %+v, want kind %v header %d end %d patterns %q", tt.lineNo, block, tt.kind, tt.header, tt.end, tt.patterns)
+		}
+	}
+}
+
+func TestMetaSpan(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		lineNo   int
+		from, to int
+	}{
+		{"comment above", "# 55h: tags=a\nHost a\n    User x\n", 2, 0, 2},
+		{"comment below at end of file", "Host a\n    User x\n# 55h: tags=a\n", 1, 0, 2},
+		{"comment below before blank", "Host a\n    User x\n# 55h: tags=a\n\nHost b\n", 1, 0, 2},
+		{"comment below belongs to next block", "Host a\n    User x\n# 55h: tags=b\nHost b\n", 1, 0, 1},
+		{"plain comments are not metadata", "# web\nHost a\n    User x\n", 2, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			block, err := doc.FindBlock(tt.lineNo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if from, to := doc.metaSpan(block); from != tt.from || to != tt.to {
+				t.Errorf("metaSpan = %d, %d, want %d, %d", from, to, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+// docEditTest applies edit to text and compares the result.
+type docEditTest struct {
+	name string
+	text string
+	edit func(doc *ConfigDocument) error
+	want string
+}
+
+func runDocEditTests(t *testing.T, tests []docEditTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			if err := tt.edit(doc); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveBlock(t *testing.T) {
+	remove := func(lineNo int) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error { return doc.RemoveBlock(lineNo) }
+	}
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "middle block takes one blank line",
+			text: "Host a\n    User x\n\nHost b\n    User y\n\nHost c\n",
+			edit: remove(4),
+			want: "Host a\n    User x\n\nHost c\n",
+		},
+		{
+			name: "first block",
+			text: "Host a\n    User x\n\nHost b\n",
+			edit: remove(1),
+			want: "Host b\n",
+		},
+		{
+			name: "last block drops the blank lines before it",
+			text: "Host a\n    User x\n\n\nHost b\n    User y\n",
+			edit: remove(5),
+			want: "Host a\n    User x\n",
+		},
+		{
+			name: "adjacent blocks without blank lines",
+			text: "Host a\nHost b\n    User y\nHost c\n",
+			edit: remove(2),
+			want: "Host a\nHost c\n",
+		},
+		{
+			name: "metadata comments go with the block",
+			text: "Host a\n\n# 55h: tags=b\nHost b\n    User y\n# 55h: note=n\n\nHost c\n",
+			edit: remove(4),
+			want: "Host a\n\nHost c\n",
+		},
+		{
+			name: "plain comments above go with the block",
+			text: "Host a\n\n# about b\nHost b\n\nHost c\n",
+			edit: remove(4),
+			want: "Host a\n\nHost c\n",
+		},
+		{
+			name: "crlf",
+			text: "Host a\r\n\r\nHost b\r\n    User y\r\n",
+			edit: remove(3),
+			want: "Host a\r\n",
+		},
+	})
+}
+
+func TestRemoveBlockComments(t *testing.T) {
+	remove := func(lineNo int) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error { return doc.RemoveBlock(lineNo) }
+	}
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "leading comments go with the block",
+			text: "Host a\n\n# about b\n# 55h: tags=b\nHost b\n    User y\n\nHost c\n",
+			edit: remove(5),
+			want: "Host a\n\nHost c\n",
+		},
+		{
+			name: "comments after a blank line stay",
+			text: "# file header\n\nHost a\n    User x\n\nHost b\n",
+			edit: remove(3),
+			want: "# file header\n\nHost b\n",
+		},
+		{
+			name: "last block",
+			text: "Host a\n\n# about b\nHost b\n",
+			edit: remove(4),
+			want: "Host a\n",
+		},
+	})
+	doc := parseTestDocument("Host a\n\n# about b\n# 55h: tags=b\nHost b\n    User y\n\nHost c\n")
+	raw, err := doc.BlockText(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(raw, "\n"), "# about b\n# 55h: tags=b\nHost b\n    User y"; got != want {
+		t.Errorf("BlockText = %q, want %q", got, want)
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	set := func(lineNo int, key, value string) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error { return doc.SetOption(lineNo, key, value) }
+	}
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "existing value keeps separator and comment",
+			text: "Host a\n  Port = 22 # default\n",
+			edit: set(1, "port", "2222"),
+			want: "Host a\n  Port = 2222 # default\n",
+		},
+		{
+			name: "only the first occurrence changes",
+			text: "Host a\n    User x\n    User y\n",
+			edit: set(1, "User", "z"),
+			want: "Host a\n    User z\n    User y\n",
+		},
+		{
+			name: "new key follows the block's style",
+			text: "Host a\n\tHostName=a.example.com\n\nHost b\n",
+			edit: set(1, "port", "22"),
+			want: "Host a\n\tHostName=a.example.com\n\tPort=22\n\nHost b\n",
+		},
+		{
+			name: "new key in an empty block uses the document's style",
+			text: "Host a\n\nHost b\n  User x\n",
+			edit: set(1, "Port", "22"),
+			want: "Host a\n  Port 22\n\nHost b\n  User x\n",
+		},
+		{
+			name: "other blocks are not touched",
+			text: "Host a\n    Port 1\nHost b\n    Port 2\n",
+			edit: set(3, "Port", "3"),
+			want: "Host a\n    Port 1\nHost b\n    Port 3\n",
+		},
+	})
+}
+
+func TestAppendOptions(t *testing.T) {
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "after the last directive, before trailing comments",
+			text: "Host a\n    User x\n\n# next\nHost b\n",
+			edit: func(doc *ConfigDocument) error {
+				return doc.AppendOptions(1, [][2]string{{"localforward", "8080 localhost:80"}, {"LocalForward", "8443 localhost:443"}})
+			},
+			want: "Host a\n    User x\n    LocalForward 8080 localhost:80\n    LocalForward 8443 localhost:443\n\n# next\nHost b\n",
+		},
+		{
+			name: "file without final newline",
+			text: "Host a\n  User x",
+			edit: func(doc *ConfigDocument) error {
+				return doc.AppendOptions(1, [][2]string{{"Port", "22"}})
+			},
+			want: "Host a\n  User x\n  Port 22\n",
+		},
+	})
+}
+
+func TestUnsetOption(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		lineNo  int
+		key     string
+		want    string
+		removed int
+	}{
+		{"every occurrence", "Host a\n    IdentityFile k1\n    User x\n    identityfile k2\n", 1, "IdentityFile", "Host a\n    User x\n", 2},
+		{"only in the block", "Host a\n    User x\nHost b\n    User y\n", 3, "user", "Host a\n    User x\nHost b\n", 1},
+		{"missing key", "Host a\n    User x\n", 1, "Port", "Host a\n    User x\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parseTestDocument(tt.text)
+			removed, err := doc.UnsetOption(tt.lineNo, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(doc.Bytes()); got != tt.want || removed != tt.removed {
+				t.Errorf("got %d removed:\n%s\nwant %d removed:\n%s", removed, got, tt.removed, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertBlockAfter(t *testing.T) {
+	insert := func(lineNo int) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error {
+			_, err := doc.InsertBlockAfter(lineNo, doc.blockLines([]string{"new"}, [][2]string{{"HostName", "n"}}))
+			return err
+		}
+	}
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "before a blank line",
+			text: "Host a\n    User x\n\nHost b\n",
+			edit: insert(1),
+			want: "Host a\n    User x\n\nHost new\n    HostName n\n\nHost b\n",
+		},
+		{
+			name: "adjacent block",
+			text: "Host a\n    User x\nHost b\n",
+			edit: insert(1),
+			want: "Host a\n    User x\n\nHost new\n    HostName n\n\nHost b\n",
+		},
+		{
+			name: "after trailing metadata",
+			text: "Host a\n    User x\n# 55h: tags=a\n\nHost b\n",
+			edit: insert(1),
+			want: "Host a\n    User x\n# 55h: tags=a\n\nHost new\n    HostName n\n\nHost b\n",
+		},
+		{
+			name: "end of file",
+			text: "Host a\n    User x",
+			edit: insert(1),
+			want: "Host a\n    User x\n\nHost new\n    HostName n\n",
+		},
+	})
+
+	doc := parseTestDocument("Host a\n    User x\n\nHost b\n")
+	header, err := doc.InsertBlockAfter(1, doc.blockLines([]string{"new"}, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != 4 || doc.Lines[header-1].Raw != "Host new" {
+		t.Errorf("InsertBlockAfter returned line %d", header)
+	}
+	if _, err := doc.InsertBlockAfter(2, nil); err == nil {
+		t.Error("InsertBlockAfter on a non-header line should fail")
+	}
+}
+
+func TestInsertBlockBefore(t *testing.T) {
+	insert := func(lineNo int) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error {
+			_, err := doc.InsertBlockBefore(lineNo, doc.blockLines([]string{"new"}, [][2]string{{"HostName", "n"}}))
+			return err
+		}
+	}
+	runDocEditTests(t, []docEditTest{
+		{
+			name: "after a blank line",
+			text: "Host a\n    User x\n\nHost *\n    User y\n",
+			edit: insert(4),
+			want: "Host a\n    User x\n\nHost new\n    HostName n\n\nHost *\n    User y\n",
+		},
+		{
+			name: "adjacent block",
+			text: "Host a\n    User x\nHost *\n",
+			edit: insert(3),
+			want: "Host a\n    User x\n\nHost new\n    HostName n\n\nHost *\n",
+		},
+		{
+			name: "above the comments of the block",
+			text: "Host a\n\n# defaults\nHost *\n",
+			edit: insert(4),
+			want: "Host a\n\nHost new\n    HostName n\n\n# defaults\nHost *\n",
+		},
+		{
+			name: "start of file",
+			text: "Match user root\n    User x\n",
+			edit: insert(1),
+			want: "Host new\n    HostName n\n\nMatch user root\n    User x\n",
+		},
+	})
+}
+
+func TestRenamePattern(t *testing.T) {
+	rename := func(oldPattern, newPattern string) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error { return doc.RenamePattern(1, oldPattern, newPattern) }
+	}
+	runDocEditTests(t, []docEditTest{
+		{"only pattern", "Host web\n    User x\n", rename("web", "www"), "Host www\n    User x\n"},
+		{"keeps quoted neighbours", "Host \"my web\" web  10.0.0.5 # prod\n", rename("web", "www"), "Host \"my web\" www  10.0.0.5 # prod\n"},
+		{"quoted pattern", "Host \"web\"\tdb\n", rename("web", "www"), "Host www\tdb\n"},
+		{"key=value", "Host=web db\n", rename("db", "pg"), "Host=web pg\n"},
+	})
+
+	doc := parseTestDocument("Host web db\n")
+	if err := doc.RenamePattern(1, "nope", "x"); err == nil {
+		t.Error("RenamePattern of a missing pattern should fail")
+	}
+}
+
+func TestRemovePattern(t *testing.T) {
+	remove := func(pattern string) func(*ConfigDocument) error {
+		return func(doc *ConfigDocument) error { return doc.RemovePattern(1, pattern) }
+	}
+	runDocEditTests(t, []docEditTest{
+		{"first", "Host web db\n", remove("web"), "Host db\n"},
+		{"middle", "Host a web\tb\n", remove("web"), "Host a\tb\n"},
+		{"last", "Host a web # prod\n", remove("web"), "Host a # prod\n"},
+		{"keeps quoted neighbours", "Host \"my web\" web \"db 1\"\n", remove("web"), "Host \"my web\" \"db 1\"\n"},
+		{"quoted pattern", "Host a \"my web\" b\n", remove("my web"), "Host a b\n"},
+		{"repeated", "Host web a web\n", remove("web"), "Host a\n"},
+	})
+
+	doc := parseTestDocument("Host web\n")
+	if err := doc.RemovePattern(1, "web"); err == nil {
+		t.Error("RemovePattern of the only pattern should fail")
+	}
+	if err := doc.RemovePattern(1, "nope"); err == nil {
+		t.Error("RemovePattern of a missing pattern should fail")
+	}
+}
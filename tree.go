@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Grouping modes of the host list, cycled with g. The empty mode is the
+// flat list.
+const (
+	groupNone   = ""
+	groupFile   = "file"
+	groupDomain = "domain"
+	groupPrefix = "prefix"
+)
+
+var groupModes = []string{groupNone, groupFile, groupDomain, groupPrefix}
+
+// Names of the groups for entries a mode has no key for.
+const (
+	groupNoDomain   = "(no domain)"
+	groupIPAddress  = "(ip address)"
+	groupNoPrefix   = "(no prefix)"
+	groupMatchRules = "(match rules)"
+)
+
+// listRow is one row of the host list: a group header, or the entry at
+// Filtered[Entry] when Entry is not -1.
+type listRow struct {
+	Group string
+	Entry int
+}
+
+func (row listRow) IsGroup() bool {
+	return row.Entry < 0
+}
+
+// groupKey returns the group entry is listed under in the current mode.
+func (state *AppState) groupKey(entry HostEntry) string {
+	switch state.Config.GroupBy {
+	case groupFile:
+		return state.relativeSourcePath(entry.SourcePath)
+	case groupDomain:
+		if entry.IsMatch() {
+			return groupMatchRules
+		}
+		return hostDomain(entry.HostName)
+	case groupPrefix:
+		if entry.IsMatch() {
+			return groupMatchRules
+		}
+		if len(entry.Patterns) == 0 {
+			return groupNoPrefix
+		}
+		return aliasPrefix(entry.Patterns[0])
+	}
+	return ""
+}
+
+// relativeSourcePath shows path relative to the directory of the main
+// config when it is below it.
+func (state *AppState) relativeSourcePath(path string) string {
+	base := state.ConfigPath
+	if abs, err := filepath.Abs(base); err == nil {
+		base = abs
+	}
+	if rel, err := filepath.Rel(filepath.Dir(base), path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// hostDomain is the HostName without its first label, so db1.prod.example.com
+// and web.prod.example.com share prod.example.com.
+func hostDomain(hostName string) string {
+	if hostName == "" {
+		return groupNoDomain
+	}
+	if net.ParseIP(hostName) != nil {
+		return groupIPAddress
+	}
+	_, domain, ok := strings.Cut(strings.TrimSuffix(strings.ToLower(hostName), "."), ".")
+	if !ok || domain == "" {
+		return groupNoDomain
+	}
+	return domain
+}
+
+// aliasPrefix is the alias up to and including its first "-", "_" or ".",
+// so prod-db-1 and prod-web share prod-.
+func aliasPrefix(alias string) string {
+	if i := strings.IndexAny(alias, "-_."); i > 0 {
+		return alias[:i+1]
+	}
+	return groupNoPrefix
+}
+
+// buildRows lays out Filtered as list rows. Groups appear in the order of
+// their first entry, so a ranked search keeps the best group on top.
+func (state *AppState) buildRows() {
+	state.Rows = nil
+	if state.Config.GroupBy == groupNone {
+		for i := range state.Filtered {
+			state.Rows = append(state.Rows, listRow{Entry: i})
+		}
+		return
+	}
+	order := []string{}
+	members := map[string][]int{}
+	for i, entry := range state.Filtered {
+		key := state.groupKey(entry)
+		if _, seen := members[key]; !seen {
+			order = append(order, key)
+		}
+		members[key] = append(members[key], i)
+	}
+	for _, key := range order {
+		state.Rows = append(state.Rows, listRow{Group: key, Entry: -1})
+		if state.Collapsed[key] {
+			continue
+		}
+		for _, i := range members[key] {
+			state.Rows = append(state.Rows, listRow{Group: key, Entry: i})
+		}
+	}
+}
+
+// rowOf returns the list row of Filtered[index], or -1 when its group is
+// collapsed.
+func (state *AppState) rowOf(index int) int {
+	for row, r := range state.Rows {
+		if r.Entry == index {
+			return row
+		}
+	}
+	return -1
+}
+
+// groupEntries returns the Filtered indexes listed under group.
+func (state *AppState) groupEntries(group string) []int {
+	indexes := []int{}
+	for i, entry := range state.Filtered {
+		if state.groupKey(entry) == group {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// selectedGroup returns the group header under the list cursor.
+func (state *AppState) selectedGroup() (string, bool) {
+	row := state.HostList.GetCurrentItem()
+	if row < 0 || row >= len(state.Rows) || !state.Rows[row].IsGroup() {
+		return "", false
+	}
+	return state.Rows[row].Group, true
+}
+
+// groupRowText is the label of a group header: a fold marker, the name and
+// how many hosts it holds.
+func (state *AppState) groupRowText(group string) string {
+	marker := "▾"
+	if state.Collapsed[group] {
+		marker = "▸"
+	}
+	return fmt.Sprintf("[::b]%s %s[::B] (%d)", marker, tview.Escape(group), len(state.groupEntries(group)))
+}
+
+// setGroupCollapsed folds or unfolds group and keeps the cursor on its
+// header.
+func (state *AppState) setGroupCollapsed(group string, collapsed bool) {
+	if state.Collapsed[group] == collapsed {
+		return
+	}
+	if state.Collapsed == nil {
+		state.Collapsed = map[string]bool{}
+	}
+	state.Collapsed[group] = collapsed
+	state.fillHostList(-1)
+	for row, r := range state.Rows {
+		if r.IsGroup() && r.Group == group {
+			state.selectRow(row)
+			return
+		}
+	}
+}
+
+// toggleAllGroups collapses every group, or expands them all when they
+// already are.
+func (state *AppState) toggleAllGroups() {
+	if state.Config.GroupBy == groupNone {
+		return
+	}
+	groups := []string{}
+	allCollapsed := true
+	for _, r := range state.Rows {
+		if r.IsGroup() {
+			groups = append(groups, r.Group)
+			allCollapsed = allCollapsed && state.Collapsed[r.Group]
+		}
+	}
+	if state.Collapsed == nil {
+		state.Collapsed = map[string]bool{}
+	}
+	for _, group := range groups {
+		state.Collapsed[group] = !allCollapsed
+	}
+	current, _ := state.selectedEntry()
+	state.fillHostList(-1)
+	if !allCollapsed {
+		state.selectRow(0)
+		return
+	}
+	state.selectEntry(current.SourcePath, firstPattern(current))
+}
+
+// handleTreeKey folds groups with ← and →: ← on a host jumps to its group
+// header, → on a collapsed header opens it. It reports whether the key was
+// used.
+func (state *AppState) handleTreeKey(expand bool) bool {
+	if state.Config.GroupBy == groupNone {
+		return false
+	}
+	row := state.HostList.GetCurrentItem()
+	if row < 0 || row >= len(state.Rows) {
+		return false
+	}
+	r := state.Rows[row]
+	switch {
+	case r.IsGroup():
+		state.setGroupCollapsed(r.Group, !expand)
+	case !expand:
+		state.setGroupCollapsed(r.Group, true)
+	}
+	return true
+}
+
+// cycleGrouping switches to the next grouping mode and saves it.
+func (state *AppState) cycleGrouping() {
+	next := 0
+	for i, mode := range groupModes {
+		if mode == state.Config.GroupBy {
+			next = (i + 1) % len(groupModes)
+		}
+	}
+	current, hasCurrent := state.selectedEntry()
+	state.Config.GroupBy = groupModes[next]
+	state.Collapsed = nil
+	state.saveAppConfig()
+	state.fillHostList(-1)
+	if hasCurrent {
+		state.selectEntry(current.SourcePath, firstPattern(current))
+	}
+	label := "flat list"
+	if state.Config.GroupBy != groupNone {
+		label = "grouped by " + state.Config.GroupBy
+	}
+	state.setStatus(state.currentTheme().MarkupAccent, "Hosts "+label)
+}
+
+// hostListTitle names the grouping and sort mode in the list border.
+func (state *AppState) hostListTitle() string {
+	title := " Hosts "
+	if state.Config.GroupBy != groupNone {
+		title += "by " + state.Config.GroupBy + " "
+	}
+	if state.sortMode() != sortConfig {
+		title += "· " + state.sortMode() + " "
+	}
+	return title
+}
+
+// renderGroupDetails summarises a group header in the detail panel.
+func (state *AppState) renderGroupDetails(group string) {
+	state.DetailTable.Clear()
+	state.DetailTable.SetTitle(fmt.Sprintf(" Details: %s ", tview.Escape(group)))
+	indexes := state.groupEntries(group)
+	aliases := []string{}
+	checked, ok := 0, 0
+	for _, i := range indexes {
+		entry := state.Filtered[i]
+		if entry.IsMatch() || len(entry.Patterns) == 0 {
+			continue
+		}
+		aliases = append(aliases, entry.Patterns[0])
+		if result, found := state.Checks[entry.Patterns[0]]; found && result.Status != CheckRunning {
+			checked++
+			if result.Status == CheckOK {
+				ok++
+			}
+		}
+	}
+	rows := [][2]string{
+		{"GroupBy", state.Config.GroupBy},
+		{"Hosts", fmt.Sprintf("%d", len(indexes))},
+	}
+	if state.Config.GroupBy == groupFile && len(indexes) > 0 {
+		rows = append(rows, [2]string{"File", state.Filtered[indexes[0]].SourcePath})
+	}
+	if checked > 0 {
+		rows = append(rows, [2]string{"Checked", fmt.Sprintf("%d ok of %d", ok, checked)})
+	}
+	rows = append(rows, [2]string{"Aliases", tview.Escape(strings.Join(aliases, ", "))})
+	for i, row := range rows {
+		labelCell := tview.NewTableCell("[::b]" + row[0])
+		valueCell := tview.NewTableCell(row[1])
+		labelCell.SetTextColor(state.currentTheme().Label)
+		valueCell.SetTextColor(state.currentTheme().Text)
+		valueCell.SetExpansion(1)
+		state.DetailTable.SetCell(i, 0, labelCell)
+		state.DetailTable.SetCell(i, 1, valueCell)
+	}
+}
+
+func firstPattern(entry HostEntry) string {
+	if len(entry.Patterns) == 0 {
+		return ""
+	}
+	return entry.Patterns[0]
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// undoKeep is how many operations u can step back through, across
+// restarts.
+const undoKeep = 20
+
+// undoFile is one file an operation wrote: the backup holding what it
+// replaced and a hash of what it wrote. An empty Backup means the file did
+// not exist before; an empty Hash means the operation removed it.
+type undoFile struct {
+	Path   string `json:"path"`
+	Backup string `json:"backup,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+// undoOp is one config mutation, such as a delete or a rename that touched
+// several files.
+type undoOp struct {
+	Reason string     `json:"reason"`
+	Time   string     `json:"time"`
+	Files  []undoFile `json:"files"`
+}
+
+// undoJournal holds the undo and redo stacks, most recent last. Undoing an
+// operation writes the backups it points to, and that write backs up the
+// content it replaces; the resulting operation is what redo applies.
+type undoJournal struct {
+	Undo []undoOp `json:"undo,omitempty"`
+	Redo []undoOp `json:"redo,omitempty"`
+}
+
+func getUndoPath() string {
+	configPath := getAppConfigPath()
+	if configPath == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(configPath), "undo.json")
+}
+
+func loadUndoJournal() undoJournal {
+	journal := undoJournal{}
+	path := getUndoPath()
+	if path == "" {
+		return journal
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		return journal
+	}
+	_ = json.Unmarshal(data, &journal)
+	return journal
+}
+
+func saveUndoJournal(journal undoJournal) error {
+	path := getUndoPath()
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if len(journal.Undo) > undoKeep {
+		journal.Undo = journal.Undo[len(journal.Undo)-undoKeep:]
+	}
+	if len(journal.Redo) > undoKeep {
+		journal.Redo = journal.Redo[len(journal.Redo)-undoKeep:]
+	}
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordUndo pushes a new operation; anything that could be redone is
+// dropped, as in an editor.
+func recordUndo(reason string, files []undoFile) {
+	if len(files) == 0 {
+		return
+	}
+	journal := loadUndoJournal()
+	journal.Undo = append(journal.Undo, undoOp{Reason: reason, Time: time.Now().Format(time.RFC3339), Files: files})
+	journal.Redo = nil
+	_ = saveUndoJournal(journal)
+}
+
+// saveDocuments writes docs as one undoable operation. Files written before
+// an error are still recorded, so a partial write can be undone.
+func saveDocuments(reason string, docs ...*ConfigDocument) error {
+	files := []undoFile{}
+	var err error
+	for _, doc := range docs {
+		var change undoFile
+		if change, err = writeConfigFile(doc.Path, doc.Bytes(), reason); err != nil {
+			break
+		}
+		if change.Path != "" {
+			files = append(files, change)
+		}
+	}
+	recordUndo(reason, files)
+	return err
+}
+
+// readBackup returns the content of backup id, or nil for the empty ID of a
+// file that did not exist.
+func readBackup(id string) ([]byte, error) {
+	if id == "" {
+		return nil, nil
+	}
+	data, err := Backup{ID: id}.Content()
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("backup %s is no longer kept", id)
+	}
+	return data, err
+}
+
+// restoreBackup gives path the content of backup id, or removes it when id
+// is empty, and returns the change as an undoFile.
+func restoreBackup(path, id, reason string) (undoFile, error) {
+	if id != "" {
+		content, err := readBackup(id)
+		if err != nil {
+			return undoFile{}, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return undoFile{}, err
+		}
+		return writeConfigFile(path, content, reason)
+	}
+	current, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return undoFile{}, nil
+	}
+	if err != nil {
+		return undoFile{}, err
+	}
+	backup, err := saveBackup(path, current, reason)
+	if err != nil {
+		return undoFile{}, fmt.Errorf("failed to back up %s: %v", path, err)
+	}
+	if err := os.Remove(path); err != nil {
+		return undoFile{}, err
+	}
+	return undoFile{Path: path, Backup: backup.ID}, nil
+}
+
+// currentHash is the hash undoFile.Hash is compared with: empty for a file
+// that does not exist.
+func currentHash(path string) (string, []byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return contentHash(data), data, nil
+}
+
+// preview checks that every file of op still holds what op wrote and
+// returns the diff that reverting it would make.
+func (op undoOp) preview() (string, error) {
+	var diff strings.Builder
+	for _, file := range op.Files {
+		hash, current, err := currentHash(file.Path)
+		if err != nil {
+			return "", err
+		}
+		if hash != file.Hash {
+			return "", fmt.Errorf("%s was changed after %q; use 55h backups to restore it", file.Path, op.Reason)
+		}
+		restored, err := readBackup(file.Backup)
+		if err != nil {
+			return "", err
+		}
+		diff.WriteString(unifiedDiff(file.Path, current, restored))
+	}
+	return diff.String(), nil
+}
+
+// revert writes the backups of op and returns the operation that reverts
+// the revert.
+func (op undoOp) revert(reason string) (undoOp, error) {
+	if _, err := op.preview(); err != nil {
+		return undoOp{}, err
+	}
+	inverse := undoOp{Reason: op.Reason, Time: op.Time}
+	for _, file := range op.Files {
+		change, err := restoreBackup(file.Path, file.Backup, reason)
+		if err != nil {
+			return inverse, err
+		}
+		if change.Path != "" {
+			inverse.Files = append(inverse.Files, change)
+		}
+	}
+	return inverse, nil
+}
+
+// undoLast reverts the newest operation of the undo stack (or of the redo
+// stack when redo is set) and moves it to the other one.
+func undoLast(redo bool) (undoOp, error) {
+	journal := loadUndoJournal()
+	from, to := &journal.Undo, &journal.Redo
+	verb := "undo "
+	if redo {
+		from, to = &journal.Redo, &journal.Undo
+		verb = "redo "
+	}
+	if len(*from) == 0 {
+		return undoOp{}, fmt.Errorf("nothing to %s", strings.TrimSpace(verb))
+	}
+	op := (*from)[len(*from)-1]
+	inverse, err := op.revert(verb + op.Reason)
+	if err != nil && len(inverse.Files) == 0 {
+		return op, err
+	}
+	*from = (*from)[:len(*from)-1]
+	*to = append(*to, inverse)
+	if saveErr := saveUndoJournal(journal); err == nil {
+		err = saveErr
+	}
+	return op, err
+}
+
+// showUndoModal shows what u (or Ctrl-r when redo is set) would restore and
+// applies it on y.
+func (state *AppState) showUndoModal(redo bool) {
+	theme := state.currentTheme()
+	journal := loadUndoJournal()
+	stack, verb := journal.Undo, "Undo"
+	if redo {
+		stack, verb = journal.Redo, "Redo"
+	}
+	if len(stack) == 0 {
+		state.setStatus(theme.MarkupWarning, "Nothing to "+strings.ToLower(verb))
+		return
+	}
+	op := stack[len(stack)-1]
+	diff, err := op.preview()
+	if err != nil {
+		state.showMessageModal(verb, tview.Escape(err.Error()))
+		return
+	}
+
+	state.ThemeModalOpen = true
+	state.App.EnableMouse(false)
+
+	modalBox := tview.NewFlex().SetDirection(tview.FlexRow)
+	modalBox.SetBorder(true)
+	modalBox.SetTitle(fmt.Sprintf(" %s: %s ", verb, tview.Escape(op.Reason)))
+	modalBox.SetTitleAlign(tview.AlignCenter)
+	modalBox.SetBackgroundColor(theme.PanelBg)
+	modalBox.SetBorderColor(theme.Border)
+	modalBox.SetTitleColor(theme.Text)
+
+	when := op.Time
+	if t, err := time.Parse(time.RFC3339, op.Time); err == nil {
+		when = t.Format("2006-01-02 15:04:05")
+	}
+	lines := []string{
+		fmt.Sprintf("%s [%s]%s[-] from %s?", verb, theme.MarkupAccent, tview.Escape(op.Reason), when),
+		"",
+	}
+	lines = append(lines, diffMarkup(diff, theme)...)
+
+	msgText := tview.NewTextView()
+	msgText.SetDynamicColors(true)
+	msgText.SetWrap(false)
+	msgText.SetBackgroundColor(theme.PanelBg)
+	msgText.SetTextColor(theme.Text)
+	msgText.SetBorderPadding(1, 0, 2, 2)
+	msgText.SetText(strings.Join(lines, "\n"))
+
+	footerText := tview.NewTextView()
+	footerText.SetTextAlign(tview.AlignCenter)
+	footerText.SetTextColor(theme.Muted)
+	footerText.SetBackgroundColor(theme.PanelBg)
+	footerText.SetText(fmt.Sprintf("y %s  ↑/↓ scroll  Esc cancel", strings.ToLower(verb)))
+
+	modalBox.AddItem(msgText, 0, 1, false)
+	modalBox.AddItem(footerText, 1, 0, false)
+
+	closeModal := func() {
+		state.App.EnableMouse(true)
+		state.Pages.RemovePage("undo-modal")
+		state.ThemeModalOpen = false
+		state.App.SetFocus(state.HostList)
+	}
+
+	apply := func() {
+		closeModal()
+		op, err := undoLast(redo)
+		state.reload()
+		if err != nil {
+			state.showMessageModal("Error", tview.Escape(err.Error()))
+			return
+		}
+		past := "Undid "
+		if redo {
+			past = "Redid "
+		}
+		state.setStatus(theme.MarkupAccent, past+op.Reason)
+	}
+
+	modalBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Rune() == 'y' || event.Rune() == 'Y' || event.Key() == tcell.KeyEnter:
+			apply()
+		case event.Key() == tcell.KeyUp || event.Key() == tcell.KeyDown:
+			row, col := msgText.GetScrollOffset()
+			if event.Key() == tcell.KeyUp && row > 0 {
+				row--
+			} else if event.Key() == tcell.KeyDown {
+				row++
+			}
+			msgText.ScrollTo(row, col)
+		case event.Key() == tcell.KeyEsc || event.Rune() == 'n' || event.Rune() == 'N':
+			closeModal()
+		}
+		return nil
+	})
+
+	modalWidth := 76
+	// Text rows plus top padding, footer and border, at most 30.
+	modalHeight := len(lines) + 4
+	if modalHeight > 30 {
+		modalHeight = 30
+	}
+	modalFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexColumn).
+			AddItem(nil, 0, 1, false).
+			AddItem(modalBox, modalWidth, 0, true).
+			AddItem(nil, 0, 1, false), modalHeight, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	state.Pages.AddPage("undo-modal", modalFlex, true, true)
+	state.App.SetFocus(modalBox)
+}
+
+// diffMarkup colours a unified diff for a TextView, one string per line.
+func diffMarkup(diff string, theme AppTheme) []string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines = append(lines, "[::b]"+tview.Escape(line)+"[::B]")
+		case strings.HasPrefix(line, "@@"):
+			lines = append(lines, fmt.Sprintf("[%s]%s[-]", theme.MarkupAccent, tview.Escape(line)))
+		case strings.HasPrefix(line, "+"):
+			lines = append(lines, fmt.Sprintf("[%s]%s[-]", theme.MarkupSuccess, tview.Escape(line)))
+		case strings.HasPrefix(line, "-"):
+			lines = append(lines, fmt.Sprintf("[%s]%s[-]", theme.MarkupError, tview.Escape(line)))
+		default:
+			lines = append(lines, tview.Escape(line))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// undoTestFile is one file an undo test writes; an empty before means the
+// file does not exist yet.
+type undoTestFile struct {
+	name   string
+	before string
+	after  string
+}
+
+// saveTestFiles creates the before state of files in dir and writes their
+// after state as one operation.
+func saveTestFiles(t *testing.T, dir string, files []undoTestFile) {
+	t.Helper()
+	docs := []*ConfigDocument{}
+	for _, file := range files {
+		path := filepath.Join(dir, file.name)
+		if file.before != "" {
+			if err := os.WriteFile(path, []byte(file.before), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		docs = append(docs, parseConfigDocumentBytes(path, []byte(file.after)))
+	}
+	if err := saveDocuments("test edit", docs...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkTestFiles reports files of dir whose content is not what state
+// returns for them; an empty string means the file must not exist.
+func checkTestFiles(t *testing.T, dir string, files []undoTestFile, state func(undoTestFile) string) {
+	t.Helper()
+	for _, file := range files {
+		want := state(file)
+		data, err := os.ReadFile(filepath.Join(dir, file.name))
+		if want == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("%s = %q, %v; want no file", file.name, data, err)
+			}
+			continue
+		}
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", file.name, data, err, want)
+		}
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []undoTestFile
+	}{
+		{
+			name:  "edit",
+			files: []undoTestFile{{name: "config", before: "Host a\n", after: "Host b\n"}},
+		},
+		{
+			name:  "new file",
+			files: []undoTestFile{{name: "config", after: "Host a\n"}},
+		},
+		{
+			name: "two files",
+			files: []undoTestFile{
+				{name: "config", before: "Include work\n\nHost a\n", after: "Include work\n"},
+				{name: "work", before: "Host w\n", after: "Host w\n\nHost a\n"},
+			},
+		},
+	}
+	before := func(file undoTestFile) string { return file.before }
+	after := func(file undoTestFile) string { return file.after }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHome(t)
+			dir := t.TempDir()
+			saveTestFiles(t, dir, tt.files)
+			checkTestFiles(t, dir, tt.files, after)
+
+			if _, err := undoLast(false); err != nil {
+				t.Fatalf("undo: %v", err)
+			}
+			checkTestFiles(t, dir, tt.files, before)
+			if _, err := undoLast(false); err == nil {
+				t.Error("second undo succeeded with an empty undo stack")
+			}
+
+			if _, err := undoLast(true); err != nil {
+				t.Fatalf("redo: %v", err)
+			}
+			checkTestFiles(t, dir, tt.files, after)
+			if _, err := undoLast(true); err == nil {
+				t.Error("second redo succeeded with an empty redo stack")
+			}
+		})
+	}
+}
+
+func TestUndoRefusesChangedFile(t *testing.T) {
+	files := []undoTestFile{{name: "config", before: "Host a\n", after: "Host b\n"}}
+	tests := []struct {
+		name   string
+		change func(path string) error
+		want   string
+	}{
+		{
+			name:   "edited on disk",
+			change: func(path string) error { return os.WriteFile(path, []byte("Host c\n"), 0600) },
+			want:   "Host c\n",
+		},
+		{
+			name:   "removed",
+			change: os.Remove,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestHome(t)
+			dir := t.TempDir()
+			saveTestFiles(t, dir, files)
+			if err := tt.change(filepath.Join(dir, "config")); err != nil {
+				t.Fatal(err)
+			}
+			_, err := undoLast(false)
+			if err == nil || !strings.Contains(err.Error(), "was changed after") {
+				t.Fatalf("undo error = %v, want a changed-file error", err)
+			}
+			checkTestFiles(t, dir, files, func(undoTestFile) string { return tt.want })
+			// The operation stays on the stack for when the file is put back.
+			if journal := loadUndoJournal(); len(journal.Undo) != 1 || len(journal.Redo) != 0 {
+				t.Errorf("journal has %d undo and %d redo entries, want 1 and 0", len(journal.Undo), len(journal.Redo))
+			}
+		})
+	}
+}
+
+func TestSaveDocumentsDropsRedo(t *testing.T) {
+	useTestHome(t)
+	dir := t.TempDir()
+	saveTestFiles(t, dir, []undoTestFile{{name: "config", before: "Host a\n", after: "Host b\n"}})
+	if _, err := undoLast(false); err != nil {
+		t.Fatal(err)
+	}
+	saveTestFiles(t, dir, []undoTestFile{{name: "config", before: "Host a\n", after: "Host c\n"}})
+	if _, err := undoLast(true); err == nil {
+		t.Error("redo succeeded after a new edit")
+	}
+}